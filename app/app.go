@@ -1,19 +1,148 @@
 package app
 
 import (
+	"os"
+	"fmt"
 	"log"
+	"sync"
+	"errors"
+	"syscall"
+	"context"
+	"net/http"
+	"os/signal"
 	"todogin/internal/api"
 	"todogin/internal/config"
 	"todogin/internal/database"
+	"todogin/internal/api/handlers/todo"
+	"todogin/internal/api/handlers/auth"
 )
 
+// exit codes of the todoapi binary
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitConfig   = 3
+	exitDatabase = 4
+)
+
+// Run starts the server and exits the process when it cannot start or stops
 func Run() {
 	conf, err := config.ConfigInit()
-	log.Printf("(config.ConfigInit): Err: %v\n", err)
+	if err != nil {
+		log.Printf("(config.ConfigInit): Err: %v\n", err)
+		os.Exit(exitConfig)
+	}
+
+	var db *database.Database
+	var todoStore todo.TodoStore
+	var userStore auth.UserStore
+
+	if conf.DBDriver == database.DriverMemory {
+		log.Println("using in-memory storage, data will be lost on restart")
+		todoStore = todo.NewMemoryStorage()
+		userStore = auth.NewMemoryStorage()
+	} else {
+		db, err = database.DatabaseInit(conf)
+		if err != nil {
+			log.Printf("(database.DatabaseInit): Err: %v\n", err)
+			os.Exit(exitDatabase)
+		}
+
+		if conf.DBMigrateOnStart {
+			if err := db.MigrateUp(); err != nil {
+				log.Printf("(db.MigrateUp): Err: %v\n", err)
+				os.Exit(exitDatabase)
+			}
+		}
+
+		todoStore = todo.NewStorage(db)
+		userStore = auth.NewStorage(db)
+	}
+
+	// SIGINT and SIGTERM stop the server and the background workers
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	todo.StartTrashPurger(ctx, &workers, todoStore, conf.TrashRetention, conf.TrashPurgeInterval)
+
+	var notifier todo.Notifier = todo.LogNotifier{}
+	if conf.ReminderWebhookURL != "" {
+		notifier = todo.NewWebhookNotifier(conf.ReminderWebhookURL)
+	}
+	todo.StartReminderScheduler(ctx, &workers, todoStore, notifier, conf.ReminderInterval)
+
+	err = api.NewApi(conf, todoStore, userStore).Run(ctx)
+
+	// the workers also stop when the server could not start
+	stop()
+	workers.Wait()
+	if db != nil {
+		db.Close()
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("(api.Run): Err: %v\n", err)
+		os.Exit(exitFailure)
+	}
+}
+
+// Migrate runs a migrate subcommand (up, down, status or redo) and returns the exit code
+func Migrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("usage: todoapi migrate up|down|status|redo")
+		return exitUsage
+	}
+
+	conf, err := config.ConfigInit()
+	if err != nil {
+		log.Printf("(config.ConfigInit): Err: %v\n", err)
+		return exitConfig
+	}
 
 	db, err := database.DatabaseInit(conf)
-	log.Printf("(database.DatabaseInit): Err: %v\n", err)
+	if err != nil {
+		log.Printf("(database.DatabaseInit): Err: %v\n", err)
+		return exitDatabase
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		err = db.MigrateUp()
+	case "down":
+		err = db.MigrateDown()
+	case "redo":
+		err = db.MigrateRedo()
+	case "status":
+		err = printMigrationStatus(db)
+	default:
+		fmt.Printf("unknown migrate command %q, use up|down|status|redo\n", args[0])
+		return exitUsage
+	}
+
+	if err != nil {
+		log.Printf("(migrate %s): Err: %v\n", args[0], err)
+		return exitDatabase
+	}
+	return exitOK
+}
+
+func printMigrationStatus(db *database.Database) error {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-30s %s\n", "Applied At", "Migration")
+	for _, s := range status {
+		appliedAt := "Pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-30s %s\n", appliedAt, s.Name)
+	}
 
-	api := api.ApiInit(db, conf)
-	api.Run()
+	return nil
 }
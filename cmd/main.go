@@ -1,9 +1,14 @@
 package main
 
 import (
+	"os"
 	"todogin/app"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(app.Migrate(os.Args[2:]))
+	}
+
 	app.Run()
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+	"context"
 	"net/http"
 	"todogin/internal/config"
 	"github.com/gin-gonic/gin"
@@ -10,18 +12,32 @@ import (
 	"todogin/internal/api/handlers/auth"
 )
 
+// the /v1/todo routes are deprecated in favour of /v1/todos
+var (
+	todoDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	todoSunsetAt     = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+)
+
 type Api struct {
-	db     *database.Database 
-	config *config.Config
-	router *gin.Engine 
+	config    *config.Config
+	router    *gin.Engine 
+	todoStore todo.TodoStore
+	userStore auth.UserStore
 }
 
 func ApiInit(db *database.Database, conf *config.Config) *Api {
+	return NewApi(conf, todo.NewStorage(db), auth.NewStorage(db))
+}
+
+// NewApi builds the api on top of the given stores, so it can run on any
+// storage backend (e.g. todo.NewMemoryStorage and auth.NewMemoryStorage)
+func NewApi(conf *config.Config, todoStore todo.TodoStore, userStore auth.UserStore) *Api {
 	api := new(Api)
 
-	api.db     = db
-	api.router = gin.Default()
-	api.config = conf
+	api.router    = gin.Default()
+	api.config    = conf
+	api.todoStore = todoStore
+	api.userStore = userStore
 
 	// logger
 	api.RegisterV1Routes()
@@ -52,19 +68,55 @@ func (api *Api) RegisterV1Routes() {
 	auth.RegisterHandlers(authRouter)
 
 	// todo routes
+	todosRouter := v1Router.Group("todos")
+	todosRouter.Use(auth.AuthMiddleware())
+	todo.RegisterResourceHandlers(todosRouter)
+
+	// tag routes
+	tagsRouter := v1Router.Group("tags")
+	tagsRouter.Use(auth.AuthMiddleware())
+	todo.RegisterTagHandlers(tagsRouter)
+
+	// deprecated todo routes
 	todoRouter := v1Router.Group("todo") 
+	todoRouter.Use(handlers.Deprecated(todoDeprecatedAt, todoSunsetAt, "/v1/todos"))
 	todoRouter.Use(auth.AuthMiddleware())
 	todo.RegisterHandlers(todoRouter)
 }
 
 func (api *Api) InitMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
-        c.Set("database", api.db)
         c.Set("config", api.config)
+        c.Set("todo_store", api.todoStore)
+        c.Set("user_store", api.userStore)
         c.Next()
     }
 }
 
-func (api *Api) Run() {
-	api.router.Run(api.config.ServerAddr)
+func (api *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.router.ServeHTTP(w, r)
+}
+
+// shutdownTimeout bounds the wait for the requests in flight on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Run serves until ctx is done, then stops accepting connections and waits
+// for the requests in flight
+func (api *Api) Run(ctx context.Context) error {
+	srv := &http.Server{Addr: api.config.ServerAddr, Handler: api.router}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"io"
+	"fmt"
+	"log"
+	"testing"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"net/http/httptest"
+	"todogin/internal/config"
+	"github.com/gin-gonic/gin"
+	"todogin/internal/database"
+)
+
+// TestDeprecatedTodoRoutes walks every route of the older /v1/todo group,
+// they answer as before with the deprecation headers
+func TestDeprecatedTodoRoutes(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	api, tok := testApi(t, 256)
+
+	routes := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", "/v1/todo/?limit=5", "", http.StatusOK},
+		{"POST", "/v1/todo/create", `{"title":"Legacy todo","content":"some content"}`, http.StatusCreated},
+		{"PUT", "/v1/todo/update", `{"id":1,"title":"Updated todo","content":"some content","done":true}`, http.StatusOK},
+		{"DELETE", "/v1/todo/destroy", `{"id":2}`, http.StatusOK},
+		{"GET", "/v1/todo/trash?limit=5", "", http.StatusOK},
+		{"POST", "/v1/todo/restore", `{"id":2}`, http.StatusOK},
+		{"GET", "/v1/todo/search?q=number", "", http.StatusOK},
+		{"GET", "/v1/todo/3", "", http.StatusOK},
+		{"GET", "/v1/todo/1/history", "", http.StatusOK},
+		{"POST", "/v1/todo/1/revert", `{"revision_id":1}`, http.StatusOK},
+		{"DELETE", "/v1/todo/destroy", `{"id":4}`, http.StatusOK},
+		{"DELETE", "/v1/todo/trash", "", http.StatusOK},
+	}
+
+	for _, route := range routes {
+		w := serve(api, route.method, route.path, route.body, tok)
+		if w.Code != route.code {
+			t.Errorf("%s %s: %d %s, want %d", route.method, route.path, w.Code, w.Body.String(), route.code)
+		}
+		if w.Header().Get("Deprecation") == "" || w.Header().Get("Sunset") == "" || !strings.Contains(w.Header().Get("Link"), "/v1/todos") {
+			t.Errorf("%s %s: no deprecation headers", route.method, route.path)
+		}
+	}
+}
+
+// TestDeprecatedSearch searches on the older /v1/todo/search and on
+// /v1/todos/search, they find the same todos
+func TestDeprecatedSearch(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	api, tok := testApi(t, 256)
+
+	hits := make([]string, 0, 2)
+	for _, path := range []string{"/v1/todo/search?q=number+4", "/v1/todos/search?q=number+4"} {
+		w := serve(api, "GET", path, "", tok)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		hits = append(hits, string(resp.Data))
+	}
+	if hits[0] != hits[1] {
+		t.Errorf("/v1/todo/search found %s, /v1/todos/search found %s", hits[0], hits[1])
+	}
+	if !strings.Contains(hits[0], "Todo number 4") {
+		t.Errorf("no hits in %s", hits[0])
+	}
+}
+
+// TestTodoVersions writes todo 1 with the version in the If-Match header, in
+// the body, in both and in neither, a stale version answers 412 with the
+// current todo and its ETag
+func TestTodoVersions(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	api, tok := testApi(t, 256)
+
+	steps := []struct {
+		name    string
+		method  string
+		ifMatch string
+		body    string
+		code    int
+		etag    string
+	}{
+		{"current If-Match", "PUT", `"1"`, `{"title":"Todo number 0","content":"some content","done":true}`, http.StatusOK, `"2"`},
+		{"stale If-Match", "PUT", `"1"`, `{"title":"Todo number 0","content":"some content"}`, http.StatusPreconditionFailed, `"2"`},
+		{"stale body version", "PUT", "", `{"title":"Todo number 0","content":"some content","version":1}`, http.StatusPreconditionFailed, `"2"`},
+		{"If-Match and body differ", "PUT", `"2"`, `{"title":"Todo number 0","content":"some content","version":1}`, http.StatusBadRequest, ""},
+		{"If-Match and body agree", "PUT", `"2"`, `{"title":"Todo number 0","content":"some content","version":2}`, http.StatusOK, `"3"`},
+		{"weak If-Match", "PATCH", `W/"3"`, `{"done":false}`, http.StatusOK, `"4"`},
+		{"no version", "PATCH", "", `{"done":true}`, http.StatusOK, `"5"`},
+		{"stale patch", "PATCH", "", `{"done":false,"version":4}`, http.StatusPreconditionFailed, `"5"`},
+		{"invalid If-Match", "PATCH", "version 5", `{"done":false}`, http.StatusBadRequest, ""},
+		{"stale delete", "DELETE", `"4"`, "", http.StatusPreconditionFailed, `"5"`},
+		{"any version", "DELETE", "*", "", http.StatusOK, ""},
+	}
+
+	for _, step := range steps {
+		r := request(step.method, "/v1/todos/1", step.body, tok)
+		if step.ifMatch != "" {
+			r.Header.Set("If-Match", step.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+
+		if w.Code != step.code {
+			t.Errorf("%s: %d %s, want %d", step.name, w.Code, w.Body.String(), step.code)
+			continue
+		}
+		if step.etag != "" && w.Header().Get("ETag") != step.etag {
+			t.Errorf("%s: ETag %s, want %s", step.name, w.Header().Get("ETag"), step.etag)
+		}
+		if step.code != http.StatusPreconditionFailed {
+			continue
+		}
+
+		// a stale write carries the todo as it is now
+		var resp struct {
+			Data struct {
+				Todo struct {
+					Version int `json:"version"`
+				} `json:"todo"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if etag := fmt.Sprintf("%q", fmt.Sprint(resp.Data.Todo.Version)); etag != step.etag {
+			t.Errorf("%s: current todo at version %d, want %s", step.name, resp.Data.Todo.Version, step.etag)
+		}
+	}
+}
+
+// BenchmarkListTodos measures GET /v1/todo/ on sqlite with the prepared
+// statements cached and with every query prepared per call, as before the
+// statement registry
+func BenchmarkListTodos(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+
+	for _, bench := range []struct {
+		name string
+		size int
+	}{
+		{"cached", 256},
+		{"uncached", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			api, tok := testApi(b, bench.size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if code, body := call(api, "GET", "/v1/todo/?limit=20", "", tok); code != http.StatusOK {
+					b.Fatalf("GET /v1/todo/: %d %s", code, body)
+				}
+			}
+		})
+	}
+}
+
+// testApi is an api on a migrated sqlite :memory: database with a signed
+// in user owning 50 todos, it returns the api and the token of the user
+func testApi(b testing.TB, stmtCacheSize int) (*Api, string) {
+	b.Helper()
+
+	conf := &config.Config{
+		DBDriver        : database.DriverSQLite,
+		DBPath          : ":memory:",
+		DBStmtCacheSize : stmtCacheSize,
+		JwtTokenLifetime: "3600",
+		JwtSecretKey    : "bench",
+	}
+
+	db, err := database.DatabaseInit(conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	if err := db.MigrateUp(); err != nil {
+		b.Fatal(err)
+	}
+
+	api := ApiInit(db, conf)
+	call(api, "POST", "/v1/auth/signup", `{"name":"bench","email":"bench@example.com","password":"password1"}`, "")
+	code, body := call(api, "POST", "/v1/auth/signin", `{"email":"bench@example.com","password":"password1"}`, "")
+	if code != http.StatusOK {
+		b.Fatalf("signin: %d %s", code, body)
+	}
+
+	var resp struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		todo := fmt.Sprintf(`{"title":"Todo number %d","content":"some content"}`, i)
+		if code, body := call(api, "POST", "/v1/todos", todo, resp.Data.Token); code != http.StatusCreated {
+			b.Fatalf("POST /v1/todos: %d %s", code, body)
+		}
+	}
+
+	return api, resp.Data.Token
+}
+
+func call(api *Api, method, path, body, tok string) (int, string) {
+	w := serve(api, method, path, body, tok)
+	return w.Code, w.Body.String()
+}
+
+func serve(api *Api, method, path, body, tok string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, request(method, path, body, tok))
+	return w
+}
+
+// request is a json request signed in with tok when it is set
+func request(method, path, body, tok string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if tok != "" {
+		r.Header.Set("Authorization", "Bearer "+tok)
+	}
+	return r
+}
@@ -6,9 +6,9 @@ import (
 	"errors"
 	"strconv"
 	"net/http"
-	"database/sql"
 	"todogin/internal/config"
 	"github.com/gin-gonic/gin"
+	"todogin/internal/database"
 	"golang.org/x/crypto/bcrypt"
 	"github.com/golang-jwt/jwt/v5"
 	"todogin/internal/api/handlers"
@@ -48,24 +48,22 @@ func signIn(c *gin.Context) {
 		return
 	}
 
-	store := NewStorage(c)
-	user, err := store.GetUserByEmail(req.Email)
+	store := GetStore(c)
+	user, err := store.GetUserByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		errs := make(handlers.ErrsMap, 0)
-		resp := handlers.NewResp(
-			handlers.FAIL,
-			map[string]any{},
-			nil,
-			errs,
-		)
-		if errors.Is(err, sql.ErrNoRows) {
-			resp["error"] = "email and password combination is wrong"
+		// don't tell apart unknown emails from wrong passwords
+		if errors.Is(err, database.ErrNotFound) {
+			errs := make(handlers.ErrsMap, 0)
+			resp := handlers.NewResp(
+				handlers.FAIL,
+				map[string]any{},
+				errors.New("email and password combination is wrong"),
+				errs,
+			)
 			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
-		log.Printf("(store.GetUserByEmail) Err: %v\n", err)
-		resp["error"] = "Internal Server Error"
-		c.JSON(http.StatusInternalServerError, resp)
+		handlers.AbortWithErr(c, "store.GetUserByEmail", err)
 		return
 	}
 
@@ -135,47 +133,21 @@ func signUp(c *gin.Context) {
 		return
 	}
 
-	store := NewStorage(c)
-	_, err := store.GetUserByEmail(req.Email)
-
-	errs := make(handlers.ErrsMap, 0)
-	resp := handlers.NewResp(
-		handlers.FAIL,
-		map[string]any{},
-		nil,
-		errs,
-	)
-
-	if err == nil {
-		resp["error"] = "email is already taken"
-		c.JSON(http.StatusBadRequest, resp)
-		return
-	} else {
-		if !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("(store.GetUserByEmail) Err: %v\n", err)
-			resp["error"] = "Internal Server Error"
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		}
-	}
-
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("(bcrypt.GenerateFromPassword) Err: %v\n", err)
-		resp["error"] = "Internal Server Error"
-		c.JSON(http.StatusInternalServerError, resp)
+		handlers.AbortWithErr(c, "bcrypt.GenerateFromPassword", err)
 		return
 	}
 
-	err = store.InsertUser(req.Name, req.Email, string(hash))
+	store := GetStore(c)
+	_, err = store.InsertUser(c.Request.Context(), req.Name, req.Email, string(hash))
 	if err != nil {
-		log.Printf("(store.InsertUser) Err: %v\n", err)
-		resp["error"] = "Internal Server Error"
-		c.JSON(http.StatusInternalServerError, resp)
+		handlers.AbortWithErr(c, "store.InsertUser", err)
 		return
 	}
 
-	resp = handlers.NewResp(
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
 		handlers.OK,
 		map[string]any{
 			"msg": "user has created",
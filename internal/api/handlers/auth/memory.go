@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"todogin/internal/database"
+)
+
+// MemoryStorage is a thread-safe in-memory implementation of UserStore,
+// used for tests and local demos without a database
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	nextId int
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users : make(map[int]User),
+		nextId: 1,
+	}
+}
+
+func (s *MemoryStorage) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user %s: %w", email, database.ErrNotFound)
+}
+
+func (s *MemoryStorage) GetUserById(ctx context.Context, id int) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, database.ErrNotFound)
+	}
+
+	return &user, nil
+}
+
+func (s *MemoryStorage) InsertUser(ctx context.Context, name, email, password string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return 0, fmt.Errorf("email %s: %w", email, database.ErrConflict)
+		}
+	}
+
+	id := s.nextId
+	s.users[id] = User{
+		Id      : id,
+		Name    : name,
+		Email   : email,
+		Password: password,
+	}
+	s.nextId++
+
+	return id, nil
+}
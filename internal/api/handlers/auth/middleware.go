@@ -5,9 +5,9 @@ import (
 	"errors"
 	"strings"
 	"net/http"
-	"database/sql"
 	"todogin/internal/config"
 	"github.com/gin-gonic/gin"
+	"todogin/internal/database"
 	"github.com/golang-jwt/jwt/v5"
 	"todogin/internal/api/handlers"
 )
@@ -55,18 +55,16 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		store := NewStorage(c)
-		user, err := store.GetUserById(claims.UserId)
+		store := GetStore(c)
+		user, err := store.GetUserById(c.Request.Context(), claims.UserId)
 
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
+			if errors.Is(err, database.ErrNotFound) {
 				resp["error"] = "Invalid token value" 
 				c.AbortWithStatusJSON(http.StatusUnauthorized, resp)
 				return
 			}
-			log.Printf("(store.GetUserById) Err: %v\n", err)
-			resp["error"] = "Internal Server Error"
-			c.AbortWithStatusJSON(http.StatusInternalServerError, resp)
+			handlers.AbortWithErr(c, "store.GetUserById", err)
 			return
 		}
 
@@ -1,30 +1,67 @@
 package auth
 
 import (
+	"fmt"
 	"errors"
+	"context"
 	"database/sql"
 	"github.com/gin-gonic/gin"
 	"todogin/internal/database"
 )
 
+// UserStore is what the auth handlers and middleware need from a storage backend
+type UserStore interface {
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserById(ctx context.Context, id int) (*User, error)
+	InsertUser(ctx context.Context, name, email, password string) (int, error)
+}
+
+// GetStore returns the UserStore registered on the request context
+func GetStore(c *gin.Context) UserStore {
+	return c.MustGet("user_store").(UserStore)
+}
+
+// Storage is the sql implementation of UserStore
 type Storage struct {
 	*database.Database
 }
 
-func NewStorage(c *gin.Context) *Storage {
-	db := c.MustGet("database").(*database.Database)
+func NewStorage(db *database.Database) *Storage {
 	return &Storage{Database: db}
 }
 
-func (s *Storage) GetUserByEmail(email string) (*User, error) {
-	stmt, err := s.Database.Conn.Prepare("select * from users where email=?")
+var userColumns = database.Columns(&User{}, "")
+
+func (u *User) Fields() database.Fields {
+	return database.Fields{
+		"id"      : &u.Id,
+		"name"    : &u.Name,
+		"email"   : &u.Email,
+		"password": &u.Password,
+	}
+}
+
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	// read from the primary, a sign in right after the sign up must see the
+	// new user before the replicas do
+	stmt, err := s.Database.Stmt(ctx, "select "+userColumns+" from users where email=?")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, email)
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
 	var user User
-	err = stmt.QueryRow(email).Scan(&user.Id, &user.Name, &user.Password, &user.Email)
+	err = database.ScanOne(rows, &user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %s: %w", email, database.ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -32,15 +69,25 @@ func (s *Storage) GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (s *Storage) GetUserById(id int) (*User, error) {
-	stmt, err := s.Database.Conn.Prepare("select * from users where id=?")
+func (s *Storage) GetUserById(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.ReadStmt(ctx, id, "select "+userColumns+" from users where id=?")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
 	var user User
-	err = stmt.QueryRow(id).Scan(&user.Id, &user.Name, &user.Password, &user.Email)
+	err = database.ScanOne(rows, &user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, database.ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -48,24 +95,37 @@ func (s *Storage) GetUserById(id int) (*User, error) {
 	return &user, nil
 }
 
-func (s *Storage) InsertUser(name, email, password string) error {
-	_, err := s.GetUserByEmail(email)
+func (s *Storage) InsertUser(ctx context.Context, name, email, password string) (int, error) {
+	taken, err := s.emailTaken(ctx, email)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
+		return 0, err
+	}
+	if taken {
+		return 0, fmt.Errorf("email %s: %w", email, database.ErrConflict)
 	}
 
-	stmt, err := s.Database.Conn.Prepare("insert into users(name, email, password) values (?, ?, ?)")
-	if err != nil {
-		return err
+	// a concurrent signup can take the email after the check
+	id, err := s.Database.Insert(ctx, "insert into users(name, email, password) values (?, ?, ?)", name, email, password)
+	if s.Database.Dialect.IsDuplicate(err) {
+		return 0, fmt.Errorf("email %s: %w", email, database.ErrConflict)
 	}
-	defer stmt.Close()
+	return id, err
+}
 
-	_, err = stmt.Exec(name, email, password)
+// emailTaken asks the primary, a lagging replica could miss a fresh signup
+func (s *Storage) emailTaken(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.Stmt(ctx, "select count(*) from users where email=?")
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	count := 0
+	if err := stmt.QueryRowContext(ctx, email).Scan(&count); err != nil {
+		return false, err
 	}
 
-	return nil
+	return count > 0, nil
 }
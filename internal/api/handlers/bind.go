@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"errors"
+	"reflect"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ParamError is a query parameter whose value does not fit its field
+type ParamError struct {
+	Name string
+	Err  error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid value for %s: %v", e.Name, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// BindQuery is c.ShouldBindQuery that reports a value of the wrong type as a
+// *ParamError naming the parameter, so GetErrorMsgs can show it like the
+// validation errors
+func BindQuery(c *gin.Context, obj any) error {
+	err := c.ShouldBindQuery(obj)
+
+	var validateErrs validator.ValidationErrors
+	if err == nil || errors.As(err, &validateErrs) {
+		return err
+	}
+
+	// bind the parameters one by one to find the faulty one
+	typ := reflect.TypeOf(obj).Elem()
+	for name, values := range c.Request.URL.Query() {
+		probe := reflect.New(typ).Interface()
+		if perr := binding.MapFormWithTag(probe, map[string][]string{name: values}, "form"); perr != nil {
+			return &ParamError{name, perr}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+	"net/http"
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecated marks the routes it is used on as deprecated since since
+// (RFC 9745), to be removed at sunset (RFC 8594), and links the successor
+// path that replaces them
+func Deprecated(since, sunset time.Time, successor string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	sunsetDate  := sunset.UTC().Format(http.TimeFormat)
+	link        := fmt.Sprintf("<%s>; rel=\"successor-version\"", successor)
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetDate)
+		c.Header("Link", link)
+		c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log"
+	"errors"
+	"context"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"todogin/internal/database"
+)
+
+// ErrorResp maps err to a http status and a NewResp payload, this is the
+// one place that decides how storage errors are shown to clients.
+// Unexpected errors are logged with op and reported as a generic message.
+func ErrorResp(op string, err error) (int, gin.H) {
+	status := http.StatusInternalServerError
+	msg    := "Internal Server Error"
+
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		status, msg = http.StatusNotFound, err.Error()
+	case errors.Is(err, database.ErrConflict):
+		status, msg = http.StatusConflict, err.Error()
+	case errors.Is(err, database.ErrForbidden):
+		status, msg = http.StatusForbidden, err.Error()
+	case errors.Is(err, database.ErrVersionMismatch):
+		status, msg = http.StatusPreconditionFailed, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		status, msg = http.StatusGatewayTimeout, "database query timed out"
+	case errors.Is(err, context.Canceled):
+		status, msg = http.StatusServiceUnavailable, "request canceled"
+	default:
+		log.Printf("(%s) Err: %v\n", op, err)
+	}
+
+	resp := NewResp(
+		FAIL,
+		map[string]any{},
+		errors.New(msg),
+		make(ErrsMap, 0),
+	)
+	return status, resp
+}
+
+// AbortWithErr writes the ErrorResp of err and stops the handler chain
+func AbortWithErr(c *gin.Context, op string, err error) {
+	status, resp := ErrorResp(op, err)
+	c.AbortWithStatusJSON(status, resp)
+}
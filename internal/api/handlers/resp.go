@@ -41,6 +41,12 @@ func GetErrorMsgs(obj any, err error) (ErrsMap, error) {
 		return errs, fmt.Errorf("Invalid json type for field: %q, expected type: %q", unmarshalTypeErr.Field, unmarshalTypeErr.Type)
 	}
 
+	var paramErr *ParamError
+	if errors.As(err, &paramErr) {
+		errs[paramErr.Name] = map[string]string{"type": paramErr.Error()}
+		return errs, nil
+	}
+
 	var validateErrs validator.ValidationErrors
 	if errors.As(err, &validateErrs) {
 		for _, e := range validateErrs {
@@ -48,6 +54,10 @@ func GetErrorMsgs(obj any, err error) (ErrsMap, error) {
 			field, ok := reflect.TypeOf(obj).FieldByName(e.Field())
 			if ok {
 				jsonName = field.Tag.Get("json")
+				// fields bound from the query string are named by their form tag
+				if jsonName == "" || jsonName == "-" {
+					jsonName = field.Tag.Get("form")
+				}
 			}
 
 			errs[jsonName] = make(map[string]string, 0)
@@ -61,11 +71,20 @@ func GetErrorMsgs(obj any, err error) (ErrsMap, error) {
 				errs[jsonName][e.Tag()] = fmt.Sprintf("%s cannot be exceed %s (current: %s)", jsonName, e.Param(), e.Value())
 			case "email":
 				errs[jsonName][e.Tag()] = fmt.Sprintf("invalid email value for %s (value: %s)", jsonName, e.Value())
+			case "gte":
+				errs[jsonName][e.Tag()] = fmt.Sprintf("%s should be greater than or equal to %s (current: %v)", jsonName, e.Param(), e.Value())
+			case "lte":
+				errs[jsonName][e.Tag()] = fmt.Sprintf("%s should be less than or equal to %s (current: %v)", jsonName, e.Param(), e.Value())
+			case "oneof":
+				errs[jsonName][e.Tag()] = fmt.Sprintf("%s should be one of [%s] (current: %v)", jsonName, e.Param(), e.Value())
 			default:
-				panic("(GetErrorMsgs) not implemented yet")
+				errs[jsonName][e.Tag()] = fmt.Sprintf("%s failed the %q validation (current: %v)", jsonName, e.Tag(), e.Value())
 			}
 		}
+		return errs, nil
 	}
 
-	return errs, nil
+	// anything else is a request that could not be read at all, like a
+	// query parameter of the wrong type
+	return errs, err
 }
@@ -0,0 +1,236 @@
+package todo
+
+import (
+	"fmt"
+	"errors"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"todogin/internal/api/handlers"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxBatchSize is the most writes a batch request takes
+const maxBatchSize = 100
+
+// batch modes, an atomic batch saves all of its writes or none
+const (
+	batchAtomic  = "atomic"
+	batchPartial = "partial"
+)
+
+// errBatchAborted is the error of the ops of an atomic batch that were not
+// saved because another op failed
+var errBatchAborted = errors.New("not saved, another write of the batch failed")
+
+// BatchOp is a write of a batch, Action is ActionCreate, ActionUpdate or
+// ActionDelete and picks the fields it uses
+type BatchOp struct {
+	Action  string
+	Id      int
+	Version int
+	// Scope of an ActionUpdate or ActionDelete op of a recurring todo
+	Scope   string
+	// Draft is the todo an ActionCreate op inserts, as in InsertTodo
+	Draft   Todo
+	// Patch is the change of an ActionUpdate op, as in PatchTodo
+	Patch   func(todo *Todo) error
+}
+
+// BatchResult is the outcome of a BatchOp, Todo is the todo it wrote
+type BatchResult struct {
+	Todo *Todo
+	Err  error
+}
+
+// abortedResults is the results of an atomic batch of n ops that stopped at
+// ops[failed] with err, none of its ops is saved
+func abortedResults(n, failed int, err error) []BatchResult {
+	results := make([]BatchResult, n)
+	for i := range results {
+		results[i].Err = errBatchAborted
+	}
+	results[failed].Err = err
+	return results
+}
+
+type TodoBatchReq struct {
+	// Mode is "atomic" (the default) or "partial", where every write is
+	// saved or fails on its own
+	Mode   string          `json:"mode" binding:"omitempty,oneof=atomic partial"`
+	Create []TodoCreateReq `json:"create"`
+	Update []TodoUpdateReq `json:"update"`
+	Delete []TodoDeleteReq `json:"delete"`
+}
+
+// BatchItem is the outcome of a write of a batch request, Status is the http
+// status the write would have on its own
+type BatchItem struct {
+	Status int              `json:"status"`
+	Todo   *Todo            `json:"todo,omitempty"`
+	Error  string           `json:"error,omitempty"`
+	Errors handlers.ErrsMap `json:"errors,omitempty"`
+}
+
+// batchItemOf turns the result of an op into its BatchItem, a stale write
+// carries the current todo like a single update does
+func batchItemOf(op BatchOp, res BatchResult) BatchItem {
+	if res.Err == nil {
+		status := http.StatusOK
+		if op.Action == ActionCreate {
+			status = http.StatusCreated
+		}
+		return BatchItem{Status: status, Todo: res.Todo}
+	}
+
+	if errors.Is(res.Err, errBatchAborted) {
+		return BatchItem{Status: http.StatusFailedDependency, Error: res.Err.Error()}
+	}
+
+	status, resp := handlers.ErrorResp("storage.BatchTodos", res.Err)
+	item := BatchItem{Status: status, Error: fmt.Sprint(resp["error"])}
+	var stale *StaleError
+	if errors.As(res.Err, &stale) {
+		item.Todo = &stale.Current
+	}
+	return item
+}
+
+// validateItem validates a write of a batch request, the request itself is
+// bound without looking into its writes
+func validateItem(obj any) (BatchItem, bool) {
+	err := binding.Validator.ValidateStruct(obj)
+	if err == nil {
+		return BatchItem{}, true
+	}
+
+	errs, err := handlers.GetErrorMsgs(obj, err)
+	item := BatchItem{Status: http.StatusBadRequest, Errors: errs}
+	if err != nil {
+		item.Error = err.Error()
+	}
+	return item, false
+}
+
+func batchTodos(c *gin.Context) {
+	var req TodoBatchReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	size := len(req.Create) + len(req.Update) + len(req.Delete)
+	if size == 0 || size > maxBatchSize {
+		errs := make(handlers.ErrsMap, 0)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			fmt.Errorf("a batch takes 1 to %d writes (current: %d)", maxBatchSize, size),
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	creates := make([]BatchItem, len(req.Create))
+	updates := make([]BatchItem, len(req.Update))
+	deletes := make([]BatchItem, len(req.Delete))
+
+	// the valid writes become ops, items[i] is where the result of ops[i] goes
+	ops   := make([]BatchOp, 0, size)
+	items := make([]*BatchItem, 0, size)
+	for i, w := range req.Create {
+		if item, ok := validateItem(w); !ok {
+			creates[i] = item
+			continue
+		}
+		ops   = append(ops, BatchOp{Action: ActionCreate, Draft: w.draft()})
+		items = append(items, &creates[i])
+	}
+	for i, w := range req.Update {
+		if item, ok := validateItem(w); !ok {
+			updates[i] = item
+			continue
+		}
+		ops   = append(ops, BatchOp{Action: ActionUpdate, Id: w.Id, Version: w.Version, Scope: w.Scope, Patch: w.patch})
+		items = append(items, &updates[i])
+	}
+	for i, w := range req.Delete {
+		if item, ok := validateItem(w); !ok {
+			deletes[i] = item
+			continue
+		}
+		ops   = append(ops, BatchOp{Action: ActionDelete, Id: w.Id, Version: w.Version, Scope: w.Scope})
+		items = append(items, &deletes[i])
+	}
+
+	atomic := req.Mode != batchPartial
+	status := http.StatusOK
+	switch {
+	case atomic && len(ops) < size:
+		// an invalid write fails an atomic batch before it starts
+		for _, item := range items {
+			*item = BatchItem{Status: http.StatusFailedDependency, Error: errBatchAborted.Error()}
+		}
+		status = http.StatusBadRequest
+	case len(ops) > 0:
+		userId := c.MustGet("user_id").(int)
+		storage := GetStore(c)
+
+		results, err := storage.BatchTodos(c.Request.Context(), userId, ops, atomic)
+		if err != nil {
+			handlers.AbortWithErr(c, "storage.BatchTodos", err)
+			return
+		}
+		for i, res := range results {
+			*items[i] = batchItemOf(ops[i], res)
+			if atomic && res.Err != nil && !errors.Is(res.Err, errBatchAborted) {
+				status = items[i].Status
+			}
+		}
+	}
+
+	saved := 0
+	for _, list := range [][]BatchItem{creates, updates, deletes} {
+		for _, item := range list {
+			if item.Error == "" && item.Errors == nil {
+				saved++
+			}
+		}
+	}
+
+	data := map[string]any{
+		"create"      : creates,
+		"update"      : updates,
+		"delete"      : deletes,
+		"saved_count" : saved,
+		"failed_count": size - saved,
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	if status != http.StatusOK {
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			data,
+			fmt.Errorf("batch has failed, none of its writes is saved"),
+			errs,
+		)
+		c.JSON(status, resp)
+		return
+	}
+
+	resp := handlers.NewResp(
+		handlers.OK,
+		data,
+		nil,
+		errs,
+	)
+	c.JSON(status, resp)
+}
@@ -0,0 +1,170 @@
+package todo
+
+import (
+	"errors"
+	"slices"
+	"context"
+	"testing"
+	"net/http"
+	"todogin/internal/database"
+)
+
+// batchOps creates a todo, renames a, updates a missing todo and deletes b,
+// the third op fails
+func batchOps(a, b int) []BatchOp {
+	rename := func(todo *Todo) error {
+		todo.Title = "alpha renamed"
+		return nil
+	}
+	return []BatchOp{
+		{Action: ActionCreate, Draft: Todo{Title: "charlie", Content: "some content"}},
+		{Action: ActionUpdate, Id: a, Patch: rename},
+		{Action: ActionUpdate, Id: 9999, Patch: rename},
+		{Action: ActionDelete, Id: b},
+	}
+}
+
+// statuses are the http statuses of the items of results
+func statuses(ops []BatchOp, results []BatchResult) []int {
+	out := make([]int, len(results))
+	for i, res := range results {
+		out[i] = batchItemOf(ops[i], res).Status
+	}
+	return out
+}
+
+func TestBatchAtomic(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		a := insert(t, ts.store, testUser, Todo{Title: "alpha", Content: "some content"})
+		b := insert(t, ts.store, testUser, Todo{Title: "bravo", Content: "some content"})
+
+		ops := batchOps(a, b)
+		results, err := ts.store.BatchTodos(ctx, testUser, ops, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency}
+		if got := statuses(ops, results); !slices.Equal(got, want) {
+			t.Errorf("%s: statuses %v, want %v", ts.name, got, want)
+		}
+		if !errors.Is(results[2].Err, database.ErrNotFound) {
+			t.Errorf("%s: failed with %v", ts.name, results[2].Err)
+		}
+
+		// nothing of the batch is saved, not even its revisions
+		if got := live(t, ts.store, testUser); !slices.Equal(got, []int{a, b}) {
+			t.Errorf("%s: live %v, want %v", ts.name, got, []int{a, b})
+		}
+		todo, err := ts.store.GetTodoById(ctx, a, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.Title != "alpha" || todo.Version != 1 {
+			t.Errorf("%s: rolled back todo is %q version %d", ts.name, todo.Title, todo.Version)
+		}
+		history, err := ts.store.GetTodoHistory(ctx, a, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*history) != 1 {
+			t.Errorf("%s: %d revisions after a rolled back batch", ts.name, len(*history))
+		}
+
+		// the same batch without the failing op is saved whole
+		ops = slices.Delete(ops, 2, 3)
+		results, err = ts.store.BatchTodos(ctx, testUser, ops, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = []int{http.StatusCreated, http.StatusOK, http.StatusOK}
+		if got := statuses(ops, results); !slices.Equal(got, want) {
+			t.Errorf("%s: statuses %v, want %v", ts.name, got, want)
+		}
+		if got := live(t, ts.store, testUser); !slices.Equal(got, []int{a, results[0].Todo.Id}) {
+			t.Errorf("%s: live %v after the batch", ts.name, got)
+		}
+	}
+}
+
+func TestBatchPartial(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		a := insert(t, ts.store, testUser, Todo{Title: "alpha", Content: "some content"})
+		b := insert(t, ts.store, testUser, Todo{Title: "bravo", Content: "some content"})
+
+		// every op but the missing todo is saved, each failing op rolls back
+		// its own savepoint; a stale write carries the current todo
+		ops := append(batchOps(a, b), BatchOp{Action: ActionUpdate, Id: a, Version: 1, Patch: func(todo *Todo) error {
+			todo.Done = true
+			return nil
+		}})
+		results, err := ts.store.BatchTodos(ctx, testUser, ops, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusOK, http.StatusPreconditionFailed}
+		if got := statuses(ops, results); !slices.Equal(got, want) {
+			t.Errorf("%s: statuses %v, want %v", ts.name, got, want)
+		}
+		if item := batchItemOf(ops[4], results[4]); item.Todo == nil || item.Todo.Version != 2 {
+			t.Errorf("%s: stale item carries %+v", ts.name, item.Todo)
+		}
+
+		if got := live(t, ts.store, testUser); !slices.Equal(got, []int{a, results[0].Todo.Id}) {
+			t.Errorf("%s: live %v after the batch", ts.name, got)
+		}
+		if got := trashed(t, ts.store, testUser); !slices.Equal(got, []int{b}) {
+			t.Errorf("%s: trash %v after the batch", ts.name, got)
+		}
+		todo, err := ts.store.GetTodoById(ctx, a, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.Title != "alpha renamed" || todo.Done {
+			t.Errorf("%s: todo %q done %v after the batch", ts.name, todo.Title, todo.Done)
+		}
+	}
+}
+
+// TestBatchSavepoint fails an op of a partial batch after it wrote the todo,
+// on the insert of its revision, the savepoint takes the write back
+func TestBatchSavepoint(t *testing.T) {
+	ctx   := context.Background()
+	db    := testDatabase(t)
+	store := NewStorage(db)
+
+	_, err := db.Conn.Exec("create trigger revisions_boom before insert on todo_revisions when new.title = 'boom' begin select raise(abort, 'boom'); end")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := insert(t, store, testUser, Todo{Title: "alpha", Content: "some content"})
+	retitle := func(title string) func(todo *Todo) error {
+		return func(todo *Todo) error {
+			todo.Title = title
+			return nil
+		}
+	}
+	ops := []BatchOp{
+		{Action: ActionUpdate, Id: a, Patch: retitle("boom")},
+		{Action: ActionUpdate, Id: a, Patch: retitle("alpha renamed")},
+	}
+	results, err := store.BatchTodos(ctx, testUser, ops, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err == nil || results[1].Err != nil {
+		t.Fatalf("results %v", results)
+	}
+
+	todo, err := store.GetTodoById(ctx, a, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Title != "alpha renamed" || todo.Version != 2 {
+		t.Errorf("todo %q version %d, want the failed op rolled back", todo.Title, todo.Version)
+	}
+}
@@ -0,0 +1,133 @@
+package todo
+
+import (
+	"errors"
+	"strings"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/base64"
+	"todogin/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// names of the lists a cursor can belong to
+const (
+	listTodos = "todos"
+	listTrash = "trash"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the content of the next_cursor and prev_cursor tokens, it
+// carries the whole list query so that a page only needs a token and a limit
+type cursor struct {
+	List   string     `json:"list"`
+	Sort   []SortKey  `json:"sort,omitempty"`
+	Filter ListFilter `json:"filter"`
+	Seek   Seek       `json:"seek"`
+}
+
+// cursorSecret is the key the cursors are signed with, derived from the jwt
+// secret so the auth signing key itself is not used for a second purpose
+func cursorSecret(c *gin.Context) []byte {
+	conf := c.MustGet("config").(*config.Config)
+	return deriveKey(conf.JwtSecretKey, "todo-cursor")
+}
+
+// deriveKey is the HMAC-SHA256 of purpose keyed with secret
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// encodeCursor returns the opaque token of cur, its base64 json signed with
+// a HMAC-SHA256 of secret so clients cannot forge positions or filters
+func encodeCursor(secret []byte, cur cursor) (string, error) {
+	payload, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// decodeCursor checks the signature of token and returns its cursor
+func decodeCursor(secret []byte, token string) (cursor, error) {
+	var cur cursor
+
+	enc := base64.RawURLEncoding
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return cur, errInvalidCursor
+	}
+
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return cur, errInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, &cur); err != nil {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// pageOf turns todos, listed with q.Limit+1 to know whether there is more,
+// into the page of q and the cursors of the pages around it, nil when there
+// is no such page
+func pageOf(secret []byte, list string, q ListQuery, todos []Todo) ([]Todo, any, any, error) {
+	back := q.Seek != nil && q.Seek.Back
+	more := len(todos) > q.Limit
+	if more && back {
+		todos = todos[len(todos)-q.Limit:]
+	} else if more {
+		todos = todos[:q.Limit]
+	}
+
+	if len(todos) == 0 {
+		return todos, nil, nil, nil
+	}
+
+	// the todo a seek starts from is on the page it came from
+	hasNext, hasPrev := more, q.Offset > 0
+	switch {
+	case back:
+		hasNext, hasPrev = true, more
+	case q.Seek != nil:
+		hasPrev = true
+	}
+
+	var next, prev any
+	if hasNext {
+		token, err := encodeCursor(secret, cursor{list, q.Sort, q.Filter, *SeekOf(todos[len(todos)-1], false)})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		next = token
+	}
+	if hasPrev {
+		token, err := encodeCursor(secret, cursor{list, q.Sort, q.Filter, *SeekOf(todos[0], true)})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		prev = token
+	}
+
+	return todos, next, prev, nil
+}
@@ -1,10 +1,10 @@
 package todo
 
 import (
-	"log"
-	"errors"
+	"fmt"
+	"time"
+	"strconv"
 	"net/http"
-	"database/sql"
 	"github.com/gin-gonic/gin"
 	"todogin/internal/api/handlers"
 )
@@ -14,12 +14,132 @@ func RegisterHandlers(router *gin.RouterGroup) {
 	router.POST("/create", createTodo)
 	router.PUT("/update", updateTodo)
 	router.DELETE("/destroy", deleteTodo)
+	router.GET("/trash", getTrash)
+	router.POST("/restore", restoreTodo)
+	router.DELETE("/trash", emptyTrash)
+	router.GET("/search", searchTodos)
+	router.GET("/:id", getTodo)
+	router.GET("/:id/history", getTodoHistory)
+	router.POST("/:id/revert", revertTodo)
+}
+
+// todoIdParam parses the :id path parameter, it writes the 400 response
+// and returns false when it is not a valid id
+func todoIdParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		errs := make(handlers.ErrsMap, 0)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			fmt.Errorf("invalid todo id %q", c.Param("id")),
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return 0, false
+	}
+	return id, true
+}
+
+// listQuery builds the ListQuery of req for list, it writes the 400
+// response and returns false when the sort or the cursor is invalid
+func listQuery(c *gin.Context, req TodoGetReq, list string) (ListQuery, bool) {
+	if req.Cursor != "" {
+		return cursorQuery(c, req, list)
+	}
+
+	keys, err := ParseSort(req.Sort)
+	if err != nil {
+		errs := handlers.ErrsMap{
+			"sort": {"invalid": err.Error()},
+		}
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			fmt.Errorf("invalid sort %q", req.Sort),
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return ListQuery{}, false
+	}
+
+	for field, names := range map[string]string{"tags_any": req.TagsAny, "tags_all": req.TagsAll} {
+		if len(tagNames(names)) > maxTagFilter {
+			errs := handlers.ErrsMap{
+				field: {"max": fmt.Sprintf("%s takes up to %d tags", field, maxTagFilter)},
+			}
+			resp := handlers.NewResp(
+				handlers.FAIL,
+				map[string]any{},
+				fmt.Errorf("too many tags in %s", field),
+				errs,
+			)
+			c.JSON(http.StatusBadRequest, resp)
+			return ListQuery{}, false
+		}
+	}
+
+	query := ListQuery{
+		Limit : req.Limit,
+		Offset: req.Offset,
+		Sort  : keys,
+		Filter: req.Filter(time.Now()),
+	}
+	return query, true
+}
+
+// cursorQuery is listQuery for a request with a cursor
+func cursorQuery(c *gin.Context, req TodoGetReq, list string) (ListQuery, bool) {
+	cur, err := decodeCursor(cursorSecret(c), req.Cursor)
+	if err == nil && cur.List != list {
+		err = errInvalidCursor
+	}
+	if err == nil && req.Offset != 0 {
+		err = fmt.Errorf("cursor cannot be combined with offset")
+	}
+	if err != nil {
+		errs := handlers.ErrsMap{
+			"cursor": {"invalid": err.Error()},
+		}
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return ListQuery{}, false
+	}
+
+	query := ListQuery{
+		Limit : req.Limit,
+		Sort  : cur.Sort,
+		Filter: cur.Filter,
+		Seek  : &cur.Seek,
+	}
+	return query, true
+}
+
+// bindGetReq binds req from the query string, or from the json body when
+// there is one, as the lists used to be read
+func bindGetReq(c *gin.Context, req *TodoGetReq) error {
+	if c.Request.ContentLength > 0 {
+		return c.ShouldBindJSON(req)
+	}
+	return handlers.BindQuery(c, req)
+}
+
+// fetchQuery is q asking for one more todo, so pageOf can tell whether
+// there is a page after it
+func fetchQuery(q ListQuery) ListQuery {
+	q.Limit++
+	return q
 }
 
 func getTodos(c *gin.Context) {
 	var req TodoGetReq
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindGetReq(c, &req); err != nil {
 		errs, err := handlers.GetErrorMsgs(req, err) 
 		resp := handlers.NewResp(
 			handlers.FAIL,
@@ -31,47 +151,134 @@ func getTodos(c *gin.Context) {
 		return
 	}
 
+	query, ok := listQuery(c, req, listTodos)
+	if !ok {
+		return
+	}
+
 	userId := c.MustGet("user_id").(int)
 
-	storage := NewStorage(c)
-	todos, err := storage.GetTodos(userId, req.Limit, req.Offset)
+	storage := GetStore(c)
+	todos, err := storage.GetTodos(c.Request.Context(), userId, fetchQuery(query))
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTodos", err)
+		return
+	}
+
+	page, next, prev, err := pageOf(cursorSecret(c), listTodos, query, *todos)
+	if err != nil {
+		handlers.AbortWithErr(c, "todo.pageOf", err)
+		return
+	}
+
+	data := map[string]any{
+		"todos"      : page,
+		"next_cursor": next,
+		"prev_cursor": prev,
+	}
+
+	// counting is what keyset pages avoid, only the offset mode does it
+	if query.Seek == nil {
+		totalTodoCount, err := storage.GetTotalTodoCount(c.Request.Context(), userId, query.Filter)
+		if err != nil {
+			handlers.AbortWithErr(c, "storage.GetTotalTodoCount", err)
+			return
+		}
+		data["total_todos_count"] = totalTodoCount
+	}
 
 	errs := make(handlers.ErrsMap, 0)
 	resp := handlers.NewResp(
-		handlers.FAIL,
-		map[string]any{},
-		err,
+		handlers.OK,
+		data,
+		nil,
 		errs,
 	)
-	if err != nil {
-		log.Printf("(storage.GetTodos) Err: %v\n", err)
-		resp["error"] = "Internal Server Error" 
+	c.JSON(http.StatusOK, resp)
+}
+
+func createTodo(c *gin.Context) {
+	var req TodoCreateReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
 		c.JSON(http.StatusBadRequest, resp)
 		return
 	}
 
-	totalTodoCount, err := storage.GetTotalTodoCount(userId)
+	userId := c.MustGet("user_id").(int)
+
+	storage := GetStore(c)
+	id, err := storage.InsertTodo(c.Request.Context(), req.draft(), userId)
 	if err != nil {
-		log.Printf("(storage.GetTotalTodoCount) Err: %v\n", err)
-		resp["error"] = "Internal Server Error" 
+		abortWithErr(c, "storage.InsertTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "todo creation success",
+			"id" : id,
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusCreated, resp)
+}
+
+func updateTodo(c *gin.Context) {
+	var req TodoUpdateReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err) 
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
 		c.JSON(http.StatusBadRequest, resp)
 		return
 	}
 
-	resp = handlers.NewResp(
+	version, ok := requestVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	todo, err := storage.PatchTodo(c.Request.Context(), userId, req.Id, version, req.Scope, req.patch)
+	if err != nil {
+		abortWithErr(c, "storage.PatchTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
 		handlers.OK,
 		map[string]any{
-			"todos": *todos,
-			"total_todos_count": totalTodoCount,
+			"msg" : "todo is updated",
+			"todo": *todo,
 		},
 		nil,
 		errs,
 	)
-	c.JSON(http.StatusOK, resp)
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusOK, resp) 
 }
 
-func createTodo(c *gin.Context) {
-	var req TodoCreateReq
+func deleteTodo(c *gin.Context) {
+	var req TodoDeleteReq
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		errs, err := handlers.GetErrorMsgs(req, err)
@@ -85,20 +292,64 @@ func createTodo(c *gin.Context) {
 		return
 	}
 
+	version, ok := requestVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
 	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
 
-	storage := NewStorage(c)
-	err := storage.InsertTodo(req.Title, req.Content, userId)
+	err := storage.DeleteTodo(c.Request.Context(), req.Id, userId, version, req.Scope)
 	if err != nil {
-		errs := make(handlers.ErrsMap, 0)
+		abortWithErr(c, "storage.DeleteTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "todo has moved to the trash",
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func getTrash(c *gin.Context) {
+	var req TodoGetReq
+
+	if err := bindGetReq(c, &req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err) 
 		resp := handlers.NewResp(
 			handlers.FAIL,
 			map[string]any{},
-			nil,
+			err,
 			errs,
 		)
-		log.Printf("(storage.InsertTodo) Err: %v\n", err)
-		c.JSON(http.StatusInternalServerError, resp)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	query, ok := listQuery(c, req, listTrash)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+
+	storage := GetStore(c)
+	todos, err := storage.GetTrash(c.Request.Context(), userId, fetchQuery(query))
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTrash", err)
+		return
+	}
+
+	page, next, prev, err := pageOf(cursorSecret(c), listTrash, query, *todos)
+	if err != nil {
+		handlers.AbortWithErr(c, "todo.pageOf", err)
 		return
 	}
 
@@ -106,19 +357,21 @@ func createTodo(c *gin.Context) {
 	resp := handlers.NewResp(
 		handlers.OK,
 		map[string]any{
-			"msg": "todo creation success",
+			"todos"      : page,
+			"next_cursor": next,
+			"prev_cursor": prev,
 		},
 		nil,
 		errs,
 	)
-	c.JSON(http.StatusCreated, resp)
+	c.JSON(http.StatusOK, resp)
 }
 
-func updateTodo(c *gin.Context) {
-	var req TodoUpdateReq
+func restoreTodo(c *gin.Context) {
+	var req TodoRestoreReq
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		errs, err := handlers.GetErrorMsgs(req, err) 
+		errs, err := handlers.GetErrorMsgs(req, err)
 		resp := handlers.NewResp(
 			handlers.FAIL,
 			map[string]any{},
@@ -130,50 +383,111 @@ func updateTodo(c *gin.Context) {
 	}
 
 	userId := c.MustGet("user_id").(int)
-	storage := NewStorage(c)
+	storage := GetStore(c)
+
+	err := storage.RestoreTodo(c.Request.Context(), req.Id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.RestoreTodo", err)
+		return
+	}
 
 	errs := make(handlers.ErrsMap, 0)
 	resp := handlers.NewResp(
-		handlers.FAIL,
-		map[string]any{},
+		handlers.OK,
+		map[string]any{
+			"msg": "todo has restored",
+		},
 		nil,
 		errs,
 	)
-	_, err := storage.GetTodoById(req.Id, userId)
+	c.JSON(http.StatusOK, resp)
+}
+
+func emptyTrash(c *gin.Context) {
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	n, err := storage.EmptyTrash(c.Request.Context(), userId)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			resp["error"] = "invalid todo id, todo not found"
-			c.JSON(http.StatusBadRequest, resp)
-			return
-		}
+		handlers.AbortWithErr(c, "storage.EmptyTrash", err)
+		return
+	}
 
-		log.Printf("(storage.GetTodoById) Err: %v\n", err)
-		resp["error"] = "Internal Server Error"
-		c.JSON(http.StatusInternalServerError, resp)
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg"          : "trash has emptied",
+			"deleted_count": n,
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func getTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
 		return
 	}
 
-	err = storage.UpdateTodo(userId, req.Id, req.Title, req.Content, req.Done)
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	todo, err := storage.GetTodoById(c.Request.Context(), id, userId)
 	if err != nil {
-		log.Printf("(storage.UpdateTodo) Err: %v\n", err)
-		resp["error"] = "Internal Server Error"
-		c.JSON(http.StatusInternalServerError, resp)
+		handlers.AbortWithErr(c, "storage.GetTodoById", err)
 		return
 	}
 
-	resp = handlers.NewResp(
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
 		handlers.OK,
 		map[string]any{
-			"msg": "todo is updated",
+			"todo": *todo,
 		},
 		nil,
 		errs,
 	)
-	c.JSON(http.StatusOK, resp) 
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusOK, resp)
 }
 
-func deleteTodo(c *gin.Context) {
-	var req TodoDeleteReq
+func getTodoHistory(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	revisions, err := storage.GetTodoHistory(c.Request.Context(), id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTodoHistory", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"revisions": *revisions,
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func revertTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	var req TodoRevertReq
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		errs, err := handlers.GetErrorMsgs(req, err)
@@ -188,42 +502,62 @@ func deleteTodo(c *gin.Context) {
 	}
 
 	userId := c.MustGet("user_id").(int)
-	storage := NewStorage(c)
+	storage := GetStore(c)
+
+	err := storage.RevertTodo(c.Request.Context(), id, req.RevisionId, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.RevertTodo", err)
+		return
+	}
 
 	errs := make(handlers.ErrsMap, 0)
 	resp := handlers.NewResp(
-		handlers.FAIL,
-		map[string]any{},
+		handlers.OK,
+		map[string]any{
+			"msg": "todo has reverted",
+		},
 		nil,
 		errs,
 	)
+	c.JSON(http.StatusOK, resp)
+}
 
-	_, err := storage.GetTodoById(req.Id, userId)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			resp["error"] = "invalid todo id, todo not found" 
-			c.JSON(http.StatusBadRequest, resp)
-			return
-		}
+// defaultSearchLimit is the page size of a search without limit
+const defaultSearchLimit = 20
+
+func searchTodos(c *gin.Context) {
+	var req TodoSearchReq
 
-		log.Printf("(storage.GetTodoById) Err: %v\n", err)
-		resp["error"] = "Internal Server Error" 
-		c.JSON(http.StatusInternalServerError, resp)
+	if err := handlers.BindQuery(c, &req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
 		return
 	}
 
-	err = storage.DeleteTodo(req.Id, userId)
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	hits, err := storage.SearchTodos(c.Request.Context(), userId, req.Q, req.Limit, req.Offset)
 	if err != nil {
-		log.Printf("(storage.DeleteTodo) Err: %v\n", err)
-		resp["error"] = "Internal Server Error"
-		c.JSON(http.StatusInternalServerError, resp)
+		handlers.AbortWithErr(c, "storage.SearchTodos", err)
 		return
 	}
 
-	resp = handlers.NewResp(
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
 		handlers.OK,
 		map[string]any{
-			"msg": "todo has deleted",
+			"results": *hits,
 		},
 		nil,
 		errs,
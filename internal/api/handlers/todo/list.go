@@ -0,0 +1,514 @@
+package todo
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"time"
+	"slices"
+	"strings"
+)
+
+// ListQuery is how a list of todos is filtered, ordered and paged
+type ListQuery struct {
+	Limit  int
+	Offset int
+	// Sort orders the list and the id breaks the ties, an empty Sort uses
+	// the default order of the list
+	Sort   []SortKey
+	Filter ListFilter
+	// Seek, when set, replaces Offset: the list starts next to that todo
+	Seek   *Seek
+}
+
+// Seek is the position of a todo in a sorted list, by the values of the
+// fields the list is sorted on. Keyset pages start right after it, or end
+// right before it when Back is set, so inserts don't shift them.
+type Seek struct {
+	Id          int        `json:"id"`
+	Title       string     `json:"title,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    int        `json:"priority,omitempty"`
+	Position    float64    `json:"position,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Back        bool       `json:"back,omitempty"`
+}
+
+// SeekOf returns the Seek of todo, back picks the page before it
+func SeekOf(todo Todo, back bool) *Seek {
+	return &Seek{
+		Id         : todo.Id,
+		Title      : todo.Title,
+		CreatedAt  : todo.CreatedAt,
+		UpdatedAt  : todo.UpdatedAt,
+		CompletedAt: todo.CompletedAt,
+		DueAt      : todo.DueAt,
+		Priority   : todo.Priority,
+		Position   : todo.Position,
+		DeletedAt  : todo.DeletedAt,
+		Back       : back,
+	}
+}
+
+// todo returns a Todo holding the sort values of k
+func (k *Seek) todo() Todo {
+	return Todo{
+		Id         : k.Id,
+		Title      : k.Title,
+		CreatedAt  : k.CreatedAt,
+		UpdatedAt  : k.UpdatedAt,
+		CompletedAt: k.CompletedAt,
+		DueAt      : k.DueAt,
+		Priority   : k.Priority,
+		Position   : k.Position,
+		DeletedAt  : k.DeletedAt,
+	}
+}
+
+// SortKey orders a list by one todo field, named by its json name
+type SortKey struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// ListFilter keeps the todos matching every set field, After bounds are
+// inclusive and Before bounds exclusive
+type ListFilter struct {
+	Done            *bool      `json:"done,omitempty"`
+	// Q is searched in the title and the content, ignoring case
+	Q               string     `json:"q,omitempty"`
+	CreatedAfter    *time.Time `json:"created_after,omitempty"`
+	CreatedBefore   *time.Time `json:"created_before,omitempty"`
+	UpdatedAfter    *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore   *time.Time `json:"updated_before,omitempty"`
+	CompletedAfter  *time.Time `json:"completed_after,omitempty"`
+	CompletedBefore *time.Time `json:"completed_before,omitempty"`
+	DueAfter        *time.Time `json:"due_after,omitempty"`
+	DueBefore       *time.Time `json:"due_before,omitempty"`
+	// Overdue keeps the todos not done and due before OverdueAt, or the
+	// others when false. OverdueAt is fixed by the first page so the pages
+	// of a cursor agree.
+	Overdue         *bool      `json:"overdue,omitempty"`
+	OverdueAt       *time.Time `json:"overdue_at,omitempty"`
+	SeriesId        *int       `json:"series_id,omitempty"`
+	Priority        *int       `json:"priority,omitempty"`
+	TagsAny         []string   `json:"tags_any,omitempty"`
+	TagsAll         []string   `json:"tags_all,omitempty"`
+}
+
+// sortFields are the fields a list can be sorted on
+var sortFields = []string{"id", "title", "created_at", "updated_at", "completed_at", "due_at", "priority", "position"}
+
+// ParseSort parses a comma separated list of sort fields, a field prefixed
+// with "-" sorts in descending order (e.g. "-completed_at,created_at")
+func ParseSort(s string) ([]SortKey, error) {
+	keys := make([]SortKey, 0)
+	if strings.TrimSpace(s) == "" {
+		return keys, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		key := SortKey{Field: strings.TrimSpace(part)}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field, key.Desc = key.Field[1:], true
+		}
+
+		if !isSortField(key.Field) {
+			return nil, fmt.Errorf("cannot sort on %q, sort fields are %s", key.Field, strings.Join(sortFields, ", "))
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("sort field %q is given twice", key.Field)
+		}
+		seen[key.Field] = true
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func isSortField(field string) bool {
+	for _, f := range sortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// where returns the sql conditions of f, each one prefixed by " and ",
+// with their args
+func (f ListFilter) where() (string, []any) {
+	var sb strings.Builder
+	args := make([]any, 0)
+
+	add := func(cond string, t *time.Time) {
+		if t != nil {
+			sb.WriteString(" and " + cond)
+			args = append(args, t.UTC())
+		}
+	}
+	add("created_at >= ?", f.CreatedAfter)
+	add("created_at < ?", f.CreatedBefore)
+	add("updated_at >= ?", f.UpdatedAfter)
+	add("updated_at < ?", f.UpdatedBefore)
+	add("completed_at >= ?", f.CompletedAfter)
+	add("completed_at < ?", f.CompletedBefore)
+	add("due_at >= ?", f.DueAfter)
+	add("due_at < ?", f.DueBefore)
+
+	if f.Done != nil {
+		sb.WriteString(" and done=?")
+		args = append(args, *f.Done)
+	}
+	if f.SeriesId != nil {
+		sb.WriteString(" and series_id=?")
+		args = append(args, *f.SeriesId)
+	}
+	if f.Priority != nil {
+		sb.WriteString(" and priority=?")
+		args = append(args, *f.Priority)
+	}
+	if len(f.TagsAny) > 0 {
+		sb.WriteString(" and exists (select 1 from todo_tags join tags on tags.id = todo_tags.tag_id where todo_tags.todo_id = todos.id and tags.name in (" + placeholders(len(f.TagsAny)) + "))")
+		for _, name := range f.TagsAny {
+			args = append(args, name)
+		}
+	}
+	if len(f.TagsAll) > 0 {
+		// tag names are unique per user, so a todo has all of them when it has as many
+		sb.WriteString(" and (select count(*) from todo_tags join tags on tags.id = todo_tags.tag_id where todo_tags.todo_id = todos.id and tags.name in (" + placeholders(len(f.TagsAll)) + ")) = ?")
+		for _, name := range f.TagsAll {
+			args = append(args, name)
+		}
+		args = append(args, len(f.TagsAll))
+	}
+	if f.Overdue != nil && f.OverdueAt != nil {
+		if *f.Overdue {
+			sb.WriteString(" and done=? and due_at < ?")
+			args = append(args, false, f.OverdueAt.UTC())
+		} else {
+			sb.WriteString(" and (done=? or due_at is null or due_at >= ?)")
+			args = append(args, true, f.OverdueAt.UTC())
+		}
+	}
+	if f.Q != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(f.Q)) + "%"
+		sb.WriteString(" and (lower(title) like ? escape '!' or lower(content) like ? escape '!')")
+		args = append(args, pattern, pattern)
+	}
+
+	return sb.String(), args
+}
+
+// placeholders is a list of n "?" for an in clause
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// likeEscaper escapes the like wildcards of a search text, with the "!"
+// escape character since backslashes mean different things across backends
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// match reports whether todo passes f, it is where for the memory storage
+func (f ListFilter) match(todo Todo) bool {
+	if f.Done != nil && todo.Done != *f.Done {
+		return false
+	}
+	if f.SeriesId != nil && (todo.SeriesId == nil || *todo.SeriesId != *f.SeriesId) {
+		return false
+	}
+	if f.Priority != nil && todo.Priority != *f.Priority {
+		return false
+	}
+	if len(f.TagsAny) > 0 && !slices.ContainsFunc(f.TagsAny, func(name string) bool { return hasTag(todo, name) }) {
+		return false
+	}
+	for _, name := range f.TagsAll {
+		if !hasTag(todo, name) {
+			return false
+		}
+	}
+	if f.Q != "" {
+		q := strings.ToLower(f.Q)
+		if !strings.Contains(strings.ToLower(todo.Title), q) && !strings.Contains(strings.ToLower(todo.Content), q) {
+			return false
+		}
+	}
+
+	after := func(t time.Time, bound *time.Time) bool {
+		return bound == nil || !t.Before(*bound)
+	}
+	before := func(t time.Time, bound *time.Time) bool {
+		return bound == nil || t.Before(*bound)
+	}
+
+	if !after(todo.CreatedAt, f.CreatedAfter) || !before(todo.CreatedAt, f.CreatedBefore) {
+		return false
+	}
+	if !after(todo.UpdatedAt, f.UpdatedAfter) || !before(todo.UpdatedAt, f.UpdatedBefore) {
+		return false
+	}
+	if f.CompletedAfter != nil || f.CompletedBefore != nil {
+		if todo.CompletedAt == nil {
+			return false
+		}
+		if !after(*todo.CompletedAt, f.CompletedAfter) || !before(*todo.CompletedAt, f.CompletedBefore) {
+			return false
+		}
+	}
+	if f.DueAfter != nil || f.DueBefore != nil {
+		if todo.DueAt == nil {
+			return false
+		}
+		if !after(*todo.DueAt, f.DueAfter) || !before(*todo.DueAt, f.DueBefore) {
+			return false
+		}
+	}
+	if f.Overdue != nil && f.OverdueAt != nil {
+		overdue := !todo.Done && todo.DueAt != nil && todo.DueAt.Before(*f.OverdueAt)
+		if overdue != *f.Overdue {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortKeys returns keys, or def when keys is empty, ending with the id so
+// that no two todos are equal
+func sortKeys(keys []SortKey, def []SortKey) []SortKey {
+	if len(keys) == 0 {
+		keys = def
+	}
+
+	out := make([]SortKey, 0, len(keys)+1)
+	for _, key := range keys {
+		out = append(out, key)
+		// ids are unique, nothing after them matters
+		if key.Field == "id" {
+			return out
+		}
+	}
+	return append(out, SortKey{Field: "id"})
+}
+
+// nullable reports whether field can be null, nulls sort last
+func nullable(field string) bool {
+	return field == "completed_at" || field == "due_at" || field == "deleted_at"
+}
+
+// orderBy returns the sql order by clause of keys (see sortKeys), reverse
+// flips every direction. Todos without the time come last whatever the
+// direction, or first when reversed.
+func orderBy(keys []SortKey, reverse bool) string {
+	terms := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		nulls, dir := "", ""
+		if reverse {
+			nulls = " desc"
+		}
+		if key.Desc != reverse {
+			dir = " desc"
+		}
+
+		if nullable(key.Field) {
+			terms = append(terms, key.Field+" is null"+nulls)
+		}
+		terms = append(terms, key.Field+dir)
+	}
+
+	return " order by " + strings.Join(terms, ", ")
+}
+
+// seekWhere returns the sql condition, prefixed by " and ", keeping the
+// todos after k in the order of keys (before it when k.Back), with its args
+func seekWhere(keys []SortKey, k *Seek) (string, []any) {
+	values := make([]any, len(keys))
+	bound  := k.todo()
+	for i, key := range keys {
+		values[i] = fieldValue(bound, key.Field)
+	}
+
+	ors  := make([]string, 0, len(keys))
+	args := make([]any, 0)
+	for i, key := range keys {
+		// keys[:i] equal the bound and keys[i] is past it
+		ands    := make([]string, 0, i+1)
+		andArgs := make([]any, 0, i+1)
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				ands = append(ands, keys[j].Field+" is null")
+				continue
+			}
+			ands    = append(ands, keys[j].Field+"=?")
+			andArgs = append(andArgs, values[j])
+		}
+
+		past, ok := pastBound(key, values[i], k.Back)
+		if !ok {
+			continue
+		}
+		ands = append(ands, past)
+		if values[i] != nil {
+			andArgs = append(andArgs, values[i])
+		}
+
+		ors  = append(ors, "("+strings.Join(ands, " and ")+")")
+		args = append(args, andArgs...)
+	}
+
+	if len(ors) == 0 {
+		return " and 1=0", args
+	}
+	return " and (" + strings.Join(ors, " or ") + ")", args
+}
+
+// pastBound is the condition of a column being past value in the direction
+// of key, with nulls last. ok is false when no value can be past it.
+func pastBound(key SortKey, value any, back bool) (string, bool) {
+	op := ">"
+	if key.Desc != back {
+		op = "<"
+	}
+
+	switch {
+	case !nullable(key.Field):
+		return key.Field + op + "?", true
+	case value == nil && back:
+		return key.Field + " is not null", true
+	case value == nil:
+		return "", false
+	case back:
+		return key.Field + op + "?", true
+	}
+	return "(" + key.Field + op + "? or " + key.Field + " is null)", true
+}
+
+// fieldValue returns the value of a sort field of todo, nil for a missing time
+func fieldValue(todo Todo, field string) any {
+	switch field {
+	case "id":
+		return todo.Id
+	case "title":
+		return todo.Title
+	case "created_at":
+		return todo.CreatedAt.UTC()
+	case "updated_at":
+		return todo.UpdatedAt.UTC()
+	case "completed_at":
+		if todo.CompletedAt != nil {
+			return todo.CompletedAt.UTC()
+		}
+	case "due_at":
+		if todo.DueAt != nil {
+			return todo.DueAt.UTC()
+		}
+	case "priority":
+		return todo.Priority
+	case "position":
+		return todo.Position
+	case "deleted_at":
+		if todo.DeletedAt != nil {
+			return todo.DeletedAt.UTC()
+		}
+	}
+	return nil
+}
+
+// sortTodos is orderBy for the memory storage
+func sortTodos(todos []Todo, keys []SortKey) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		return lessTodo(todos[i], todos[j], keys)
+	})
+}
+
+// seekTodos is seekWhere for the memory storage, todos must be sorted by
+// keys, it returns up to limit todos next to k
+func seekTodos(todos []Todo, keys []SortKey, k *Seek, limit int) []Todo {
+	bound := k.todo()
+	kept  := make([]Todo, 0)
+	for _, todo := range todos {
+		if (!k.Back && lessTodo(bound, todo, keys)) || (k.Back && lessTodo(todo, bound, keys)) {
+			kept = append(kept, todo)
+		}
+	}
+
+	if k.Back && len(kept) > limit {
+		return kept[len(kept)-limit:]
+	}
+	if len(kept) > limit {
+		return kept[:limit]
+	}
+	return kept
+}
+
+// lessTodo reports whether a comes before b in the order of keys
+func lessTodo(a, b Todo, keys []SortKey) bool {
+	for _, key := range keys {
+		c := compareField(a, b, key.Field)
+		if c == 0 {
+			continue
+		}
+		// a missing time always sorts last
+		if c == nullsLast || c == -nullsLast {
+			return c < 0
+		}
+		if key.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+// nullsLast is what compareField returns when only one side has no time
+const nullsLast = 2
+
+// compareField compares a field of a and b, it returns -1, 0 or 1, and
+// -nullsLast or nullsLast when the time of b or a is missing
+func compareField(a, b Todo, field string) int {
+	compareTimes := func(x, y *time.Time) int {
+		switch {
+		case x == nil && y == nil:
+			return 0
+		case x == nil:
+			return nullsLast
+		case y == nil:
+			return -nullsLast
+		}
+		return x.Compare(*y)
+	}
+
+	switch field {
+	case "id":
+		switch {
+		case a.Id < b.Id:
+			return -1
+		case a.Id > b.Id:
+			return 1
+		}
+		return 0
+	case "priority":
+		return cmp.Compare(a.Priority, b.Priority)
+	case "position":
+		return cmp.Compare(a.Position, b.Position)
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case "completed_at":
+		return compareTimes(a.CompletedAt, b.CompletedAt)
+	case "due_at":
+		return compareTimes(a.DueAt, b.DueAt)
+	case "deleted_at":
+		return compareTimes(a.DeletedAt, b.DeletedAt)
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package todo
+
+import (
+	"time"
+	"slices"
+	"context"
+	"testing"
+)
+
+// TestSeekPages walks the keyset pages of lists sorted on keys with ties and
+// missing times, forwards and backwards, they must add up to the full list
+func TestSeekPages(t *testing.T) {
+	due := func(day int) *time.Time {
+		at := time.Date(2026, time.November, day, 9, 0, 0, 0, time.UTC)
+		return &at
+	}
+	drafts := []Todo{
+		{Title: "bravo", Priority: 2, DueAt: due(3)},
+		{Title: "alpha", Priority: 1},
+		{Title: "bravo", Priority: 2},
+		{Title: "alpha", Priority: 0, DueAt: due(1)},
+		{Title: "charlie", Priority: 2, DueAt: due(3)},
+		{Title: "alpha", Priority: 1, DueAt: due(2)},
+		{Title: "bravo", Priority: 3},
+	}
+
+	sorts := []string{"", "-priority", "title,-priority", "due_at", "-due_at,title", "-title,due_at,-id", "priority,-created_at"}
+
+	for _, ts := range testStores(t) {
+		for _, draft := range drafts {
+			draft.Content = "some content"
+			insert(t, ts.store, testUser, draft)
+		}
+		// another user's todo is never on a page
+		insert(t, ts.store, otherUser, Todo{Title: "alpha", Content: "some content"})
+
+		for _, sort := range sorts {
+			keys, err := ParseSort(sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			list := func(q ListQuery) []Todo {
+				q.Sort = keys
+				todos, err := ts.store.GetTodos(context.Background(), testUser, q)
+				if err != nil {
+					t.Fatalf("%s sort %q: %v", ts.name, sort, err)
+				}
+				return *todos
+			}
+
+			full := ids(list(ListQuery{Limit: 100}))
+			if len(full) != len(drafts) {
+				t.Fatalf("%s sort %q: listed %v", ts.name, sort, full)
+			}
+
+			for _, limit := range []int{1, 2, 3} {
+				pages := make([][]Todo, 0)
+				page  := list(ListQuery{Limit: limit})
+				for len(page) > 0 {
+					pages = append(pages, page)
+					page  = list(ListQuery{Limit: limit, Seek: SeekOf(page[len(page)-1], false)})
+				}
+
+				walked := make([]int, 0)
+				for _, page := range pages {
+					walked = append(walked, ids(page)...)
+				}
+				if !slices.Equal(walked, full) {
+					t.Errorf("%s sort %q limit %d: pages %v, want %v", ts.name, sort, limit, walked, full)
+				}
+
+				// going back from a page lands on the page before it
+				for i := 1; i < len(pages); i++ {
+					back := list(ListQuery{Limit: limit, Seek: SeekOf(pages[i][0], true)})
+					if !slices.Equal(ids(back), ids(pages[i-1])) {
+						t.Errorf("%s sort %q limit %d: page before %v is %v, want %v", ts.name, sort, limit, ids(pages[i]), ids(back), ids(pages[i-1]))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSeekWhere(t *testing.T) {
+	due := time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		sort  string
+		seek  Seek
+		where string
+		args  int
+	}{
+		{"id only", "", Seek{Id: 4}, " and ((id>?))", 1},
+		{"desc with id tie break", "-priority", Seek{Id: 4, Priority: 2}, " and ((priority<?) or (priority=? and id>?))", 3},
+		{"back flips the directions", "-priority", Seek{Id: 4, Priority: 2, Back: true}, " and ((priority>?) or (priority=? and id<?))", 3},
+		{"time past a value or missing", "due_at", Seek{Id: 4, DueAt: &due}, " and (((due_at>? or due_at is null)) or (due_at=? and id>?))", 3},
+		{"missing time only ties", "due_at", Seek{Id: 4}, " and ((due_at is null and id>?))", 1},
+		{"back from a missing time", "due_at", Seek{Id: 4, Back: true}, " and ((due_at is not null) or (due_at is null and id<?))", 1},
+	}
+
+	for _, tt := range tests {
+		keys, err := ParseSort(tt.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		where, args := seekWhere(sortKeys(keys, []SortKey{}), &tt.seek)
+		if where != tt.where || len(args) != tt.args {
+			t.Errorf("%s: got %q with %d args, want %q with %d", tt.name, where, len(args), tt.where, tt.args)
+		}
+	}
+}
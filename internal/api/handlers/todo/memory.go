@@ -0,0 +1,778 @@
+package todo
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+	"slices"
+	"context"
+	"todogin/internal/database"
+)
+
+// MemoryStorage is a thread-safe in-memory implementation of TodoStore,
+// used for tests and local demos without a database
+type MemoryStorage struct {
+	mu           sync.RWMutex
+	todos        map[int]Todo
+	nextId       int
+	revisions    []Revision
+	nextRevId    int
+	series       map[int]Series
+	nextSeriesId int
+	tags         map[int]Tag
+	nextTagId    int
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		todos       : make(map[int]Todo),
+		nextId      : 1,
+		revisions   : make([]Revision, 0),
+		nextRevId   : 1,
+		series      : make(map[int]Series),
+		nextSeriesId: 1,
+		tags        : make(map[int]Tag),
+		nextTagId   : 1,
+	}
+}
+
+func (s *MemoryStorage) InsertTodo(ctx context.Context, draft Todo, userId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.insertTodo(draft, userId)
+	if err != nil {
+		return 0, err
+	}
+	return todo.Id, nil
+}
+
+func (s *MemoryStorage) GetTodos(ctx context.Context, userId int, q ListQuery) (*[]Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todos := s.listTodos(userId, false, q, todosOrder)
+	return &todos, nil
+}
+
+func (s *MemoryStorage) GetTodoById(ctx context.Context, id, userId int) (*Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, ok := s.todos[id]
+	if !ok || todo.DeletedAt != nil || (userId != 0 && todo.UserId != userId) {
+		return nil, fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
+
+	return &todo, nil
+}
+
+func (s *MemoryStorage) GetTotalTodoCount(ctx context.Context, userId int, f ListFilter) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.userTodos(userId, false, f)), nil
+}
+
+func (s *MemoryStorage) PatchTodo(ctx context.Context, userId int, todoId int, version int, scope string, patch func(todo *Todo) error) (*Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.patchTodo(userId, todoId, version, scope, ActionUpdate, patch)
+}
+
+func (s *MemoryStorage) DeleteTodo(ctx context.Context, id, userId int, version int, scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.deleteTodo(id, userId, version, scope)
+	return err
+}
+
+func (s *MemoryStorage) GetTrash(ctx context.Context, userId int, q ListQuery) (*[]Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todos := s.listTodos(userId, true, q, trashOrder)
+	return &todos, nil
+}
+
+func (s *MemoryStorage) RestoreTodo(ctx context.Context, id, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.trashTodo(id, userId, false, 0)
+	return err
+}
+
+func (s *MemoryStorage) EmptyTrash(ctx context.Context, userId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, todo := range s.todos {
+		if todo.UserId == userId && todo.DeletedAt != nil {
+			delete(s.todos, id)
+			n++
+		}
+	}
+	s.dropRevisions()
+
+	return n, nil
+}
+
+func (s *MemoryStorage) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, todo := range s.todos {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			delete(s.todos, id)
+			n++
+		}
+	}
+	s.dropRevisions()
+
+	return n, nil
+}
+
+func (s *MemoryStorage) GetTodoHistory(ctx context.Context, id, userId int) (*[]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, ok := s.todos[id]
+	if !ok || todo.UserId != userId {
+		return nil, fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
+
+	revisions := make([]Revision, 0)
+	for i := len(s.revisions) - 1; i >= 0; i-- {
+		if s.revisions[i].TodoId == id {
+			revisions = append(revisions, s.revisions[i])
+		}
+	}
+
+	return &revisions, nil
+}
+
+func (s *MemoryStorage) RevertTodo(ctx context.Context, id, revisionId, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, ok := s.todos[id]
+	if !ok || todo.UserId != userId || todo.DeletedAt != nil {
+		return fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
+
+	for _, revision := range s.revisions {
+		if revision.Id == revisionId && revision.TodoId == id {
+			_, err := s.patchTodo(userId, id, 0, ScopeThis, ActionRevert, revision.revert)
+			return err
+		}
+	}
+
+	return fmt.Errorf("revision %d of todo %d: %w", revisionId, id, database.ErrNotFound)
+}
+
+func (s *MemoryStorage) SearchTodos(ctx context.Context, userId int, q string, limit, offset int) (*[]SearchHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := searchTerms(q)
+	hits  := make([]SearchHit, 0)
+	if len(terms) == 0 {
+		return &hits, nil
+	}
+
+	for _, todo := range s.userTodos(userId, false, ListFilter{}) {
+		if rank := memoryRank(todo, terms); rank > 0 {
+			hits = append(hits, SearchHit{todo, rank, snippetOf(todo, terms)})
+		}
+	}
+
+	hits = rankHits(hits, limit, offset)
+	return &hits, nil
+}
+
+func (s *MemoryStorage) BatchTodos(ctx context.Context, userId int, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]BatchResult, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			todo, err := s.atomically(func() (*Todo, error) {
+				return s.batchOp(userId, op)
+			})
+			results[i] = BatchResult{Todo: todo, Err: err}
+		}
+		return results, nil
+	}
+
+	failed := -1
+	_, err := s.atomically(func() (*Todo, error) {
+		for i, op := range ops {
+			todo, err := s.batchOp(userId, op)
+			if err != nil {
+				failed = i
+				return nil, err
+			}
+			results[i] = BatchResult{Todo: todo}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return abortedResults(len(ops), failed, err), nil
+	}
+
+	return results, nil
+}
+
+// atomically runs write and puts everything back as it was when it fails,
+// a write only adds revisions so keeping their count is enough, caller must
+// hold the lock
+func (s *MemoryStorage) atomically(write func() (*Todo, error)) (*Todo, error) {
+	todos, series := maps.Clone(s.todos), maps.Clone(s.series)
+	nextId, revisions, nextRevId, nextSeriesId := s.nextId, len(s.revisions), s.nextRevId, s.nextSeriesId
+
+	todo, err := write()
+	if err != nil {
+		s.todos, s.series = todos, series
+		s.nextId, s.revisions, s.nextRevId, s.nextSeriesId = nextId, s.revisions[:revisions], nextRevId, nextSeriesId
+	}
+	return todo, err
+}
+
+func (s *MemoryStorage) PendingReminders(ctx context.Context, now time.Time, limit int) (*[]Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todos := make([]Todo, 0)
+	for _, todo := range s.todos {
+		if todo.RemindAt != nil && !todo.RemindAt.After(now) && todo.RemindedAt == nil && !todo.Done && todo.DeletedAt == nil {
+			todos = append(todos, todo)
+		}
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		if c := todos[i].RemindAt.Compare(*todos[j].RemindAt); c != 0 {
+			return c < 0
+		}
+		return todos[i].Id < todos[j].Id
+	})
+	todos = page(todos, limit, 0)
+	return &todos, nil
+}
+
+func (s *MemoryStorage) MarkReminded(ctx context.Context, id int, remindAt time.Time, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, ok := s.todos[id]
+	if !ok || todo.RemindAt == nil || !todo.RemindAt.Equal(*storedTime(&remindAt)) {
+		return nil
+	}
+	todo.RemindedAt = storedTime(&at)
+	s.todos[id] = todo
+	return nil
+}
+
+func (s *MemoryStorage) MoveTodo(ctx context.Context, userId int, todoId int, version int, targetId int, after bool) (*Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.todos[todoId]
+	if !ok || before.UserId != userId || before.DeletedAt != nil {
+		return nil, fmt.Errorf("todo %d: %w", todoId, database.ErrNotFound)
+	}
+	if err := checkVersion(&before, version); err != nil {
+		return nil, err
+	}
+	if err := checkTarget(todoId, targetId); err != nil {
+		return nil, err
+	}
+
+	position, ok, err := s.positionBy(userId, todoId, targetId, after)
+	if err == nil && !ok {
+		s.renumber(userId)
+		position, _, err = s.positionBy(userId, todoId, targetId, after)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	todo := before
+	todo.Position = position
+	todo.Version++
+	stamp(&before, &todo, database.Now())
+	s.todos[todoId] = todo
+	s.addRevision(ActionMove, &before, &todo, userId)
+
+	return &todo, nil
+}
+
+func (s *MemoryStorage) GetTags(ctx context.Context, userId int) (*[]Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tags := make([]Tag, 0)
+	for _, tag := range s.tags {
+		if tag.UserId == userId {
+			tags = append(tags, s.counted(tag))
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+		return tags[i].Id < tags[j].Id
+	})
+	return &tags, nil
+}
+
+func (s *MemoryStorage) GetTagById(ctx context.Context, id, userId int) (*Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tag, ok := s.tags[id]
+	if !ok || tag.UserId != userId {
+		return nil, fmt.Errorf("tag %d: %w", id, database.ErrNotFound)
+	}
+
+	tag = s.counted(tag)
+	return &tag, nil
+}
+
+func (s *MemoryStorage) InsertTag(ctx context.Context, userId int, name, color string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkTagName(userId, 0, name); err != nil {
+		return 0, err
+	}
+
+	now := database.Now()
+	tag := Tag{
+		Id       : s.nextTagId,
+		UserId   : userId,
+		Name     : name,
+		Color    : color,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.tags[tag.Id] = tag
+	s.nextTagId++
+
+	return tag.Id, nil
+}
+
+func (s *MemoryStorage) UpdateTag(ctx context.Context, id, userId int, name, color string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag, ok := s.tags[id]
+	if !ok || tag.UserId != userId {
+		return fmt.Errorf("tag %d: %w", id, database.ErrNotFound)
+	}
+	if err := s.checkTagName(userId, id, name); err != nil {
+		return err
+	}
+
+	// the todos carry the names of their tags
+	if name != tag.Name {
+		s.retag(userId, tag.Name, name)
+	}
+
+	tag.Name, tag.Color, tag.UpdatedAt = name, color, database.Now()
+	s.tags[id] = tag
+	return nil
+}
+
+func (s *MemoryStorage) DeleteTag(ctx context.Context, id, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag, ok := s.tags[id]
+	if !ok || tag.UserId != userId {
+		return fmt.Errorf("tag %d: %w", id, database.ErrNotFound)
+	}
+
+	s.retag(userId, tag.Name, "")
+	delete(s.tags, id)
+	return nil
+}
+
+func (s *MemoryStorage) TagTodo(ctx context.Context, todoId, tagId, userId int, on bool) (*Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, ok := s.todos[todoId]
+	if !ok || todo.UserId != userId || todo.DeletedAt != nil {
+		return nil, fmt.Errorf("todo %d: %w", todoId, database.ErrNotFound)
+	}
+	tag, ok := s.tags[tagId]
+	if !ok || tag.UserId != userId {
+		return nil, fmt.Errorf("tag %d: %w", tagId, database.ErrNotFound)
+	}
+
+	tagged := hasTag(todo, tag.Name)
+	switch {
+	case on && !tagged:
+		// the stored todos share their slices, never append in place
+		todo.Tags = append(slices.Clone(todo.Tags), tag.Name)
+		slices.Sort(todo.Tags)
+	case !on && tagged:
+		todo.Tags = slices.DeleteFunc(slices.Clone(todo.Tags), func(name string) bool { return name == tag.Name })
+	case !on:
+		return nil, fmt.Errorf("tag %d of todo %d: %w", tagId, todoId, database.ErrNotFound)
+	}
+	s.todos[todoId] = todo
+
+	return &todo, nil
+}
+
+// counted is tag with its count of live todos, caller must hold the lock
+func (s *MemoryStorage) counted(tag Tag) Tag {
+	tag.TodoCount = 0
+	for _, todo := range s.todos {
+		if todo.UserId == tag.UserId && todo.DeletedAt == nil && hasTag(todo, tag.Name) {
+			tag.TodoCount++
+		}
+	}
+	return tag
+}
+
+// checkTagName is Storage.checkTagName, caller must hold the lock
+func (s *MemoryStorage) checkTagName(userId, id int, name string) error {
+	for _, tag := range s.tags {
+		if tag.UserId == userId && tag.Id != id && tag.Name == name {
+			return fmt.Errorf("tag %s: %w", name, database.ErrConflict)
+		}
+	}
+	return nil
+}
+
+// retag renames the tag from to to on the todos of the user, an empty to
+// takes the tag off, caller must hold the lock
+func (s *MemoryStorage) retag(userId int, from, to string) {
+	for id, todo := range s.todos {
+		if todo.UserId != userId || !hasTag(todo, from) {
+			continue
+		}
+		tags := slices.DeleteFunc(slices.Clone(todo.Tags), func(name string) bool { return name == from })
+		if to != "" {
+			tags = append(tags, to)
+			slices.Sort(tags)
+		}
+		todo.Tags = tags
+		s.todos[id] = todo
+	}
+}
+
+// positionBy is Storage.positionBy, caller must hold the lock
+func (s *MemoryStorage) positionBy(userId, todoId, targetId int, after bool) (float64, bool, error) {
+	list := s.userTodos(userId, false, ListFilter{})
+	list  = slices.DeleteFunc(list, func(todo Todo) bool { return todo.Id == todoId })
+	sortTodos(list, sortKeys(nil, todosOrder))
+
+	i := slices.IndexFunc(list, func(todo Todo) bool { return todo.Id == targetId })
+	if i < 0 {
+		return 0, false, targetMissing(targetId, after)
+	}
+
+	target := list[i].Position
+	if after {
+		var next *float64
+		if i+1 < len(list) {
+			next = &list[i+1].Position
+		}
+		position, ok := between(&target, next)
+		return position, ok, nil
+	}
+
+	var prev *float64
+	if i > 0 {
+		prev = &list[i-1].Position
+	}
+	position, ok := between(prev, &target)
+	return position, ok, nil
+}
+
+// renumber is Storage.renumber, caller must hold the lock
+func (s *MemoryStorage) renumber(userId int) {
+	list := s.userTodos(userId, false, ListFilter{})
+	sortTodos(list, sortKeys(nil, todosOrder))
+	for i, todo := range list {
+		todo.Position = float64(i+1) * positionGap
+		s.todos[todo.Id] = todo
+	}
+}
+
+// batchOp runs an op of a batch, caller must hold the lock
+func (s *MemoryStorage) batchOp(userId int, op BatchOp) (*Todo, error) {
+	switch op.Action {
+	case ActionCreate:
+		return s.insertTodo(op.Draft, userId)
+	case ActionUpdate:
+		return s.patchTodo(userId, op.Id, op.Version, op.Scope, ActionUpdate, op.Patch)
+	case ActionDelete:
+		return s.deleteTodo(op.Id, userId, op.Version, op.Scope)
+	}
+	return nil, fmt.Errorf("unknown batch action %q", op.Action)
+}
+
+// insertTodo is InsertTodo, a draft with an rrule and no series starts one,
+// caller must hold the lock
+func (s *MemoryStorage) insertTodo(draft Todo, userId int) (*Todo, error) {
+	now  := database.Now()
+	todo := newTodo(draft, userId, now)
+	if err := checkRecurrence(nil, &todo, ScopeThis); err != nil {
+		return nil, err
+	}
+	if todo.RRule != "" && todo.SeriesId == nil {
+		series := newSeries(&todo, now)
+		s.saveSeries(&series)
+		todo.SeriesId, todo.RecurrenceAt = &series.Id, todo.DueAt
+	}
+
+	// new todos go to the end of the list
+	var last *float64
+	for _, other := range s.todos {
+		if other.UserId == userId && (last == nil || other.Position > *last) {
+			position := other.Position
+			last = &position
+		}
+	}
+	todo.Position, _ = between(last, nil)
+
+	todo.Id = s.nextId
+	s.todos[todo.Id] = todo
+	s.nextId++
+	s.addRevision(ActionCreate, nil, &todo, userId)
+
+	return &todo, nil
+}
+
+// patchTodo is PatchTodo recorded as action, caller must hold the lock
+func (s *MemoryStorage) patchTodo(userId int, todoId int, version int, scope string, action string, patch func(todo *Todo) error) (*Todo, error) {
+	before, ok := s.todos[todoId]
+	if !ok || before.UserId != userId || before.DeletedAt != nil {
+		return nil, fmt.Errorf("todo %d: %w", todoId, database.ErrNotFound)
+	}
+	if err := checkVersion(&before, version); err != nil {
+		return nil, err
+	}
+
+	todo, err := patched(&before, patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRecurrence(&before, &todo, scope); err != nil {
+		return nil, err
+	}
+	now := database.Now()
+	stamp(&before, &todo, now)
+
+	var series *Series
+	var dropLater bool
+	switch {
+	case before.SeriesId == nil && todo.RRule != "":
+		started := newSeries(&todo, now)
+		s.saveSeries(&started)
+		todo.SeriesId, todo.RecurrenceAt = &started.Id, todo.DueAt
+	case before.SeriesId != nil && scope == ScopeFuture:
+		edited, ok := s.series[*before.SeriesId]
+		if !ok {
+			return nil, fmt.Errorf("series %d: %w", *before.SeriesId, database.ErrNotFound)
+		}
+		series    = &edited
+		dropLater = series.edit(&before, &todo, now)
+		s.saveSeries(series)
+	}
+
+	s.todos[todoId] = todo
+	s.addRevision(action, &before, &todo, userId)
+
+	if series != nil {
+		if err := s.updateLater(series, &before, dropLater); err != nil {
+			return nil, err
+		}
+	}
+	if completes(&before, &todo) {
+		if err := s.advance(&todo); err != nil {
+			return nil, err
+		}
+	}
+	return &todo, nil
+}
+
+// deleteTodo is DeleteTodo, caller must hold the lock
+func (s *MemoryStorage) deleteTodo(id, userId int, version int, scope string) (*Todo, error) {
+	todo, err := s.trashTodo(id, userId, true, version)
+	if err != nil || todo.SeriesId == nil || todo.RecurrenceAt == nil {
+		return todo, err
+	}
+
+	if scope != ScopeFuture {
+		if todo.Done {
+			return todo, nil
+		}
+		return todo, s.advance(todo)
+	}
+
+	series, ok := s.series[*todo.SeriesId]
+	if !ok {
+		return nil, fmt.Errorf("series %d: %w", *todo.SeriesId, database.ErrNotFound)
+	}
+	now := database.Now()
+	series.EndedAt, series.UpdatedAt = &now, now
+	s.saveSeries(&series)
+	return todo, s.updateLater(&series, todo, true)
+}
+
+// advance makes the occurrence of the series of todo after todo, unless the
+// series has ended or the occurrence was made already, caller must hold
+// the lock
+func (s *MemoryStorage) advance(todo *Todo) error {
+	series, ok := s.series[*todo.SeriesId]
+	if !ok {
+		return fmt.Errorf("series %d: %w", *todo.SeriesId, database.ErrNotFound)
+	}
+	next, ok := series.next(*todo.RecurrenceAt)
+	if !ok {
+		return nil
+	}
+
+	for _, other := range s.todos {
+		if other.SeriesId != nil && *other.SeriesId == series.Id && sameTime(other.RecurrenceAt, storedTime(next.RecurrenceAt)) {
+			return nil
+		}
+	}
+
+	_, err := s.insertTodo(next, todo.UserId)
+	return err
+}
+
+// updateLater makes the live occurrences of series not done yet that come
+// after todo follow its template, or trashes them when drop, caller must
+// hold the lock
+func (s *MemoryStorage) updateLater(series *Series, todo *Todo, drop bool) error {
+	later := make([]Todo, 0)
+	for _, other := range s.todos {
+		if other.SeriesId != nil && *other.SeriesId == series.Id && other.Id != todo.Id && other.RecurrenceAt != nil &&
+			other.RecurrenceAt.After(*todo.RecurrenceAt) && !other.Done && other.DeletedAt == nil {
+			later = append(later, other)
+		}
+	}
+	sort.Slice(later, func(i, j int) bool { return later[i].RecurrenceAt.Before(*later[j].RecurrenceAt) })
+
+	for _, other := range later {
+		var err error
+		if drop {
+			_, err = s.trashTodo(other.Id, series.UserId, true, 0)
+		} else {
+			_, err = s.patchTodo(series.UserId, other.Id, 0, ScopeThis, ActionUpdate, series.follows)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSeries inserts series, or updates it when it has an id, caller must
+// hold the lock
+func (s *MemoryStorage) saveSeries(series *Series) {
+	if series.Id == 0 {
+		series.Id = s.nextSeriesId
+		s.nextSeriesId++
+	}
+	series.StartAt = series.StartAt.UTC()
+	s.series[series.Id] = *series
+}
+
+// trashTodo moves a todo to the trash or restores it from there, caller
+// must hold the lock
+func (s *MemoryStorage) trashTodo(id, userId int, trash bool, version int) (*Todo, error) {
+	todo, ok := s.todos[id]
+	if !ok || todo.UserId != userId || (todo.DeletedAt == nil) != trash {
+		return nil, fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
+	if err := checkVersion(&todo, version); err != nil {
+		return nil, err
+	}
+
+	before := todo
+	now    := database.Now()
+	action := ActionRestore
+	todo.Version++
+	todo.DeletedAt = nil
+	if trash {
+		todo.DeletedAt = &now
+		action = ActionDelete
+	}
+	stamp(&before, &todo, now)
+	s.todos[id] = todo
+	s.addRevision(action, &before, &todo, userId)
+
+	return &todo, nil
+}
+
+// addRevision records the change from before to after, caller must hold the lock
+func (s *MemoryStorage) addRevision(action string, before, after *Todo, userId int) {
+	revision := newRevision(action, before, after, userId, database.Now())
+	revision.Id = s.nextRevId
+	s.revisions = append(s.revisions, revision)
+	s.nextRevId++
+}
+
+// dropRevisions forgets the revisions of deleted todos, caller must hold the lock
+func (s *MemoryStorage) dropRevisions() {
+	kept := s.revisions[:0]
+	for _, revision := range s.revisions {
+		if _, ok := s.todos[revision.TodoId]; ok {
+			kept = append(kept, revision)
+		}
+	}
+	s.revisions = kept
+}
+
+// userTodos returns the todos of the user that pass f, either the trashed
+// ones or the others, in no particular order, caller must hold the lock
+func (s *MemoryStorage) userTodos(userId int, trashed bool, f ListFilter) []Todo {
+	todos := make([]Todo, 0)
+	for _, todo := range s.todos {
+		if todo.UserId == userId && (todo.DeletedAt != nil) == trashed && f.match(todo) {
+			todos = append(todos, todo)
+		}
+	}
+	return todos
+}
+
+// listTodos is the memory version of Storage.listTodos, caller must hold the lock
+func (s *MemoryStorage) listTodos(userId int, trashed bool, q ListQuery, def []SortKey) []Todo {
+	keys  := sortKeys(q.Sort, def)
+	todos := s.userTodos(userId, trashed, q.Filter)
+	sortTodos(todos, keys)
+
+	if q.Seek != nil {
+		return seekTodos(todos, keys, q.Seek, q.Limit)
+	}
+	return page(todos, q.Limit, q.Offset)
+}
+
+// page returns the limit todos after offset
+func page(todos []Todo, limit, offset int) []Todo {
+	if offset >= len(todos) {
+		return make([]Todo, 0)
+	}
+	todos = todos[offset:]
+	if limit < len(todos) {
+		todos = todos[:limit]
+	}
+	return todos
+}
@@ -0,0 +1,403 @@
+package todo
+
+import (
+	"fmt"
+	"time"
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"todogin/internal/api/handlers"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// content types of PATCH /v1/todos/:id besides application/json
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// TodoDoc is the json document of a todo the patches apply to, a patched
+// document is validated as a whole before it is saved
+type TodoDoc struct {
+	Title    string     `json:"title" binding:"required,min=5,max=100"`
+	Content  string     `json:"content" binding:"required,min=5,max=255"`
+	Done     bool       `json:"done"`
+	DueAt    *time.Time `json:"due_at" binding:"required_with=RRule"`
+	RemindAt *time.Time `json:"remind_at"`
+	RRule    string     `json:"rrule" binding:"omitempty,max=255,rrule"`
+	Priority int        `json:"priority" binding:"gte=0,lte=3"`
+}
+
+// PatchError is a patch that cannot be applied to a todo, Status is the
+// http status it is answered with
+type PatchError struct {
+	Status int
+	Err    error
+	Errs   handlers.ErrsMap
+}
+
+func (e *PatchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errPathNotFound = errors.New("path not found")
+	errTestFailed   = errors.New("test failed")
+)
+
+// docPatch computes a patched document from the current one, the document
+// is the generic json value (maps, slices, ...) of a TodoDoc
+type docPatch func(doc any) (any, error)
+
+// patchDoc applies patch to the document of todo and validates the result,
+// the errors are *PatchError
+func patchDoc(todo *Todo, patch docPatch) error {
+	var doc any
+	raw, err := json.Marshal(TodoDoc{todo.Title, todo.Content, todo.Done, todo.DueAt, todo.RemindAt, todo.RRule, todo.Priority})
+	if err == nil {
+		err = json.Unmarshal(raw, &doc)
+	}
+	if err != nil {
+		return err
+	}
+
+	doc, err = patch(doc)
+	if err != nil {
+		return err
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return &PatchError{http.StatusUnprocessableEntity, fmt.Errorf("a todo must stay a json object"), nil}
+	}
+
+	// the read only fields of a todo are unknown to TodoDoc
+	var next TodoDoc
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		errs, err := handlers.GetErrorMsgs(next, err)
+		return &PatchError{http.StatusUnprocessableEntity, err, errs}
+	}
+
+	if err := binding.Validator.ValidateStruct(&next); err != nil {
+		errs, err := handlers.GetErrorMsgs(next, err)
+		if err == nil {
+			err = fmt.Errorf("patched todo is invalid")
+		}
+		return &PatchError{http.StatusUnprocessableEntity, err, errs}
+	}
+
+	todo.Title, todo.Content, todo.Done = next.Title, next.Content, next.Done
+	todo.DueAt, todo.RemindAt, todo.RRule = next.DueAt, next.RemindAt, next.RRule
+	todo.Priority = next.Priority
+	return nil
+}
+
+// parseMergePatch reads a json merge patch (RFC 7386)
+func parseMergePatch(body []byte) (docPatch, error) {
+	var patch any
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+
+	return func(doc any) (any, error) {
+		return mergePatch(doc, patch), nil
+	}, nil
+}
+
+// mergePatch merges patch into target, a null member removes the member
+func mergePatch(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	result, ok := target.(map[string]any)
+	if !ok {
+		result = make(map[string]any)
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(result, name)
+		} else {
+			result[name] = mergePatch(result[name], value)
+		}
+	}
+	return result
+}
+
+// patchOp is an operation of a json patch (RFC 6902)
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	path, from []string
+	value      any
+}
+
+// parseJSONPatch reads a json patch (RFC 6902), it checks the operations
+// so a malformed patch is told apart from one the todo does not fit
+func parseJSONPatch(body []byte) (docPatch, error) {
+	var ops []patchOp
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, err
+	}
+
+	for i := range ops {
+		op := &ops[i]
+
+		var err error
+		if op.path, err = parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s needs a value", i, op.Op)
+			}
+			if err := json.Unmarshal(op.Value, &op.value); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "move", "copy":
+			if op.from, err = parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+
+	return func(doc any) (any, error) {
+		for i, op := range ops {
+			var err error
+			if doc, err = op.apply(doc); err != nil {
+				status := http.StatusUnprocessableEntity
+				if errors.Is(err, errTestFailed) {
+					status = http.StatusConflict
+				}
+				return nil, &PatchError{status, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err), nil}
+			}
+		}
+		return doc, nil
+	}, nil
+}
+
+func (op patchOp) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		return addValue(doc, op.path, cloneValue(op.value))
+	case "remove":
+		doc, _, err := removeValue(doc, op.path)
+		return doc, err
+	case "replace":
+		doc, _, err := removeValue(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.path, cloneValue(op.value))
+	case "move":
+		if len(op.from) < len(op.path) && reflect.DeepEqual(op.from, op.path[:len(op.from)]) {
+			return nil, fmt.Errorf("cannot move %s into itself", op.From)
+		}
+		doc, value, err := removeValue(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.path, value)
+	case "copy":
+		value, err := getValue(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.path, cloneValue(value))
+	case "test":
+		value, err := getValue(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, op.value) {
+			return nil, errTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits a json pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q", pointer)
+	}
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the token of an array element, "-" is the end of the
+// array when end is allowed
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (i == length && !end) {
+		return 0, errPathNotFound
+	}
+	return i, nil
+}
+
+func getValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return doc, nil
+}
+
+// atParent calls change with the container holding the last token of path
+// and puts the container it returns back into doc
+func atParent(doc any, path []string, change func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, errPathNotFound
+		}
+		child, err := atParent(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := atParent(node[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+	return nil, errPathNotFound
+}
+
+func addValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return atParent(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, errPathNotFound
+	})
+}
+
+// removeValue removes the value at path and returns it
+func removeValue(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+	doc, err := atParent(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i:i], node[i+1:]...), nil
+		}
+		return nil, errPathNotFound
+	})
+	return doc, removed, err
+}
+
+// cloneValue deep copies a json value, so the values a patch adds are not
+// shared with the patch or the rest of the document
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		clone := make(map[string]any, len(v))
+		for name, member := range v {
+			clone[name] = cloneValue(member)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(v))
+		for i, element := range v {
+			clone[i] = cloneValue(element)
+		}
+		return clone
+	}
+	return value
+}
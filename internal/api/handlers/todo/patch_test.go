@@ -0,0 +1,203 @@
+package todo
+
+import (
+	"time"
+	"errors"
+	"testing"
+	"net/http"
+	"encoding/json"
+)
+
+// canonical writes the json text s with its members sorted
+func canonical(t *testing.T, s string) string {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+// status is the http status of a *PatchError, 0 for other errors
+func status(err error) int {
+	var perr *PatchError
+	if errors.As(err, &perr) {
+		return perr.Status
+	}
+	return 0
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		patch  string
+		want   string
+		status int
+	}{
+		{"add a member", `{"a":1}`, `[{"op":"add","path":"/b","value":{"c":[2]}}]`, `{"a":1,"b":{"c":[2]}}`, 0},
+		{"add replaces a member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`, 0},
+		{"add inside an array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, 0},
+		{"add at the end of an array", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, 0},
+		{"add past the end of an array", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, "", http.StatusUnprocessableEntity},
+		{"add under a missing member", `{"a":1}`, `[{"op":"add","path":"/b/c","value":2}]`, "", http.StatusUnprocessableEntity},
+		{"remove a member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/b"}]`, `{"a":1}`, 0},
+		{"remove an element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, 0},
+		{"remove a missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, "", http.StatusUnprocessableEntity},
+		{"remove the end of an array", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, "", http.StatusUnprocessableEntity},
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, "", http.StatusUnprocessableEntity},
+		{"index zero", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2]}`, 0},
+		{"replace", `{"a":1}`, `[{"op":"replace","path":"/a","value":[1]}]`, `{"a":[1]}`, 0},
+		{"replace a missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":1}]`, "", http.StatusUnprocessableEntity},
+		{"replace the root", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`, 0},
+		{"move", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`, 0},
+		{"move within an array", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`, 0},
+		{"move into its own child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, "", http.StatusUnprocessableEntity},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, 0},
+		{"test passes", `{"a":{"b":[1,"x"]}}`, `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`, `{"a":{"b":[1,"x"]}}`, 0},
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2},{"op":"remove","path":"/a"}]`, "", http.StatusConflict},
+		{"test a missing member", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, "", http.StatusUnprocessableEntity},
+		{"escaped tokens", `{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`, 0},
+		{"escapes are read once", `{"~1":1,"/":2}`, `[{"op":"remove","path":"/~01"}]`, `{"/":2}`, 0},
+	}
+
+	for _, tt := range tests {
+		patch, err := parseJSONPatch([]byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		var doc any
+		if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		doc, err = patch(doc)
+		if tt.status != 0 {
+			if status(err) != tt.status {
+				t.Errorf("%s: got %v, want a %d", tt.name, err, tt.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		raw, _ := json.Marshal(doc)
+		if got := string(raw); got != canonical(t, tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONPatch(t *testing.T) {
+	invalid := map[string]string{
+		"unknown op"        : `[{"op":"frobnicate","path":"/a"}]`,
+		"no op"             : `[{"path":"/a","value":1}]`,
+		"add without value" : `[{"op":"add","path":"/a"}]`,
+		"relative pointer"  : `[{"op":"remove","path":"a"}]`,
+		"relative from"     : `[{"op":"move","from":"a","path":"/b"}]`,
+		"not a list"        : `{"op":"remove","path":"/a"}`,
+	}
+	for name, patch := range invalid {
+		if _, err := parseJSONPatch([]byte(patch)); err == nil {
+			t.Errorf("%s: %s parsed", name, patch)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"sets members", `{"a":1,"b":2}`, `{"b":3,"c":4}`, `{"a":1,"b":3,"c":4}`},
+		{"null removes", `{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{"merges nested objects", `{"a":{"b":1,"c":2}}`, `{"a":{"c":null,"d":3}}`, `{"a":{"b":1,"d":3}}`},
+		{"arrays are replaced", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"an object over a value", `{"a":1}`, `{"a":{"b":null,"c":1}}`, `{"a":{"c":1}}`},
+		{"a non object replaces all", `{"a":1}`, `[1]`, `[1]`},
+	}
+
+	for _, tt := range tests {
+		patch, err := parseMergePatch([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var doc any
+		if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		doc, _ = patch(doc)
+
+		raw, _ := json.Marshal(doc)
+		if got := string(raw); got != canonical(t, tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestPatchDoc applies patches to the document of a todo, the result is
+// validated as a whole
+func TestPatchDoc(t *testing.T) {
+	due := time.Date(2026, time.November, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		merge  bool
+		patch  string
+		status int
+		check  func(todo *Todo) bool
+	}{
+		{"replace the title", false, `[{"op":"replace","path":"/title","value":"Walk the cat"}]`, 0,
+			func(todo *Todo) bool { return todo.Title == "Walk the cat" && todo.Content == "around the block" }},
+		{"test then replace", false, `[{"op":"test","path":"/done","value":false},{"op":"replace","path":"/done","value":true}]`, 0,
+			func(todo *Todo) bool { return todo.Done }},
+		{"a failed test", false, `[{"op":"test","path":"/done","value":true},{"op":"replace","path":"/done","value":false}]`, http.StatusConflict, nil},
+		{"a title too short", false, `[{"op":"replace","path":"/title","value":"Walk"}]`, http.StatusUnprocessableEntity, nil},
+		{"a removed title", false, `[{"op":"remove","path":"/title"}]`, http.StatusUnprocessableEntity, nil},
+		{"a read only field", false, `[{"op":"add","path":"/id","value":5}]`, http.StatusUnprocessableEntity, nil},
+		{"an invalid rrule", false, `[{"op":"add","path":"/rrule","value":"FREQ=HOURLY"}]`, http.StatusUnprocessableEntity, nil},
+		{"a root that is not an object", false, `[{"op":"replace","path":"","value":[1]}]`, http.StatusUnprocessableEntity, nil},
+		{"merge fields", true, `{"done":true,"priority":2}`, 0,
+			func(todo *Todo) bool { return todo.Done && todo.Priority == 2 && todo.DueAt != nil }},
+		{"merge null removes due_at", true, `{"due_at":null}`, 0,
+			func(todo *Todo) bool { return todo.DueAt == nil && todo.Title == "Walk the dog" }},
+		{"merge a rule without due_at", true, `{"due_at":null,"rrule":"FREQ=DAILY"}`, http.StatusUnprocessableEntity, nil},
+		{"merge a priority out of range", true, `{"priority":7}`, http.StatusUnprocessableEntity, nil},
+		{"merge a non object", true, `"todo"`, http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		parse := parseJSONPatch
+		if tt.merge {
+			parse = parseMergePatch
+		}
+		patch, err := parse([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		todo := Todo{Title: "Walk the dog", Content: "around the block", DueAt: &due}
+		err   = patchDoc(&todo, patch)
+		if tt.status != 0 {
+			if status(err) != tt.status {
+				t.Errorf("%s: got %v, want a %d", tt.name, err, tt.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !tt.check(&todo) {
+			t.Errorf("%s: patched to %+v", tt.name, todo)
+		}
+	}
+}
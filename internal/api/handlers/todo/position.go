@@ -0,0 +1,57 @@
+package todo
+
+import (
+	"fmt"
+	"net/http"
+	"database/sql"
+	"todogin/internal/api/handlers"
+)
+
+// positionGap is how far apart the positions of the todos added to the end
+// of the list are, and of the todos of a renumbered list
+const positionGap = 1024.0
+
+// between is a position right between lo and hi, nil being the ends of the
+// list. ok is false when lo and hi are too close for a float between them,
+// then the list needs to be renumbered.
+func between(lo, hi *float64) (float64, bool) {
+	switch {
+	case lo == nil && hi == nil:
+		return positionGap, true
+	case lo == nil:
+		return *hi - positionGap, true
+	case hi == nil:
+		return *lo + positionGap, true
+	}
+
+	mid := *lo + (*hi-*lo)/2
+	return mid, *lo < mid && mid < *hi
+}
+
+// nullFloat is the value of f, nil when it is null
+func nullFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
+
+// checkTarget refuses to move a todo next to itself, the errors are *PatchError
+func checkTarget(todoId, targetId int) error {
+	if todoId == targetId {
+		return &PatchError{http.StatusUnprocessableEntity, fmt.Errorf("todo %d cannot move next to itself", todoId), nil}
+	}
+	return nil
+}
+
+// targetMissing is the *PatchError of a move before or after a todo that
+// is not in the list
+func targetMissing(targetId int, after bool) error {
+	field := "before"
+	if after {
+		field = "after"
+	}
+	err  := fmt.Errorf("todo %d is not in the list", targetId)
+	errs := handlers.ErrsMap{field: {"exists": err.Error()}}
+	return &PatchError{http.StatusUnprocessableEntity, err, errs}
+}
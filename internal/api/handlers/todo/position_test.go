@@ -0,0 +1,50 @@
+package todo
+
+import (
+	"slices"
+	"context"
+	"testing"
+)
+
+func TestMoveTodo(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		a := insert(t, ts.store, testUser, Todo{Title: "alpha", Content: "some content"})
+		b := insert(t, ts.store, testUser, Todo{Title: "bravo", Content: "some content"})
+		c := insert(t, ts.store, testUser, Todo{Title: "charlie", Content: "some content"})
+
+		todos, err := ts.store.GetTodos(ctx, testUser, ListQuery{Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids(*todos), []int{a, b, c}) {
+			t.Fatalf("%s: new todos listed %v, want them at the end", ts.name, ids(*todos))
+		}
+
+		moved, err := ts.store.MoveTodo(ctx, testUser, c, 0, a, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		todos, err = ts.store.GetTodos(ctx, testUser, ListQuery{Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids(*todos), []int{c, a, b}) {
+			t.Errorf("%s: moved before the first, listed %v", ts.name, ids(*todos))
+		}
+
+		// a move is its own revision, with only the position changed
+		history, err := ts.store.GetTodoHistory(ctx, c, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revision := (*history)[0]
+		if _, ok := revision.Changes["position"]; revision.Action != ActionMove || !ok || len(revision.Changes) != 1 {
+			t.Errorf("%s: move recorded as %s %v", ts.name, revision.Action, revision.Changes)
+		}
+		if moved.Version != 2 {
+			t.Errorf("%s: moved todo has version %d, want 2", ts.name, moved.Version)
+		}
+	}
+}
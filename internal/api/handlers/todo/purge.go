@@ -0,0 +1,40 @@
+package todo
+
+import (
+	"log"
+	"sync"
+	"time"
+	"context"
+)
+
+// StartTrashPurger permanently deletes the todos that stayed in the trash
+// longer than retention, it checks every interval until ctx is done and
+// then calls wg.Done, a purge it started runs to its end.
+// A zero retention keeps trashed todos forever.
+func StartTrashPurger(ctx context.Context, wg *sync.WaitGroup, store TodoStore, retention, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := store.PurgeTrash(context.WithoutCancel(ctx), time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("(store.PurgeTrash) Err: %v\n", err)
+			} else if n > 0 {
+				log.Printf("(StartTrashPurger) purged %d todos\n", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,133 @@
+package todo
+
+import (
+	"sync"
+	"time"
+	"errors"
+	"slices"
+	"context"
+	"testing"
+	"todogin/internal/database"
+)
+
+// trashed lists the ids of the trashed todos of userId, last trashed first
+func trashed(t *testing.T, store TodoStore, userId int) []int {
+	t.Helper()
+
+	todos, err := store.GetTrash(context.Background(), userId, ListQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids(*todos)
+}
+
+func live(t *testing.T, store TodoStore, userId int) []int {
+	t.Helper()
+
+	todos, err := store.GetTodos(context.Background(), userId, ListQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids(*todos)
+}
+
+func TestTrash(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		a := insert(t, ts.store, testUser, Todo{Title: "alpha", Content: "some content"})
+		b := insert(t, ts.store, testUser, Todo{Title: "bravo", Content: "some content"})
+		c := insert(t, ts.store, testUser, Todo{Title: "charlie", Content: "some content"})
+		other := insert(t, ts.store, otherUser, Todo{Title: "delta", Content: "some content"})
+
+		for _, id := range []int{a, b} {
+			if err := ts.store.DeleteTodo(ctx, id, testUser, 0, ScopeThis); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ts.store.DeleteTodo(ctx, a, testUser, 0, ScopeThis); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: deleted twice: %v", ts.name, err)
+		}
+		if err := ts.store.DeleteTodo(ctx, other, testUser, 0, ScopeThis); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: deleted the todo of another user: %v", ts.name, err)
+		}
+
+		if got := live(t, ts.store, testUser); !slices.Equal(got, []int{c}) {
+			t.Errorf("%s: live %v, want %v", ts.name, got, []int{c})
+		}
+		if got := trashed(t, ts.store, testUser); !slices.Equal(got, []int{b, a}) {
+			t.Errorf("%s: trash %v, want %v", ts.name, got, []int{b, a})
+		}
+		if _, err := ts.store.GetTodoById(ctx, a, testUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: got a trashed todo: %v", ts.name, err)
+		}
+
+		// a restored todo is back at its place in the list
+		if err := ts.store.RestoreTodo(ctx, a, testUser); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.store.RestoreTodo(ctx, a, testUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: restored twice: %v", ts.name, err)
+		}
+		if got := live(t, ts.store, testUser); !slices.Equal(got, []int{a, c}) {
+			t.Errorf("%s: restored, live %v, want %v", ts.name, got, []int{a, c})
+		}
+
+		// emptying the trash leaves the trash of other users alone
+		if err := ts.store.DeleteTodo(ctx, other, otherUser, 0, ScopeThis); err != nil {
+			t.Fatal(err)
+		}
+		n, err := ts.store.EmptyTrash(ctx, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 || len(trashed(t, ts.store, testUser)) != 0 {
+			t.Errorf("%s: emptied %d todos, trash %v", ts.name, n, trashed(t, ts.store, testUser))
+		}
+		if got := trashed(t, ts.store, otherUser); !slices.Equal(got, []int{other}) {
+			t.Errorf("%s: trash of the other user %v, want %v", ts.name, got, []int{other})
+		}
+		if _, err := ts.store.GetTodoHistory(ctx, b, testUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: history of an emptied todo: %v", ts.name, err)
+		}
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		a := insert(t, ts.store, testUser, Todo{Title: "alpha", Content: "some content"})
+		b := insert(t, ts.store, otherUser, Todo{Title: "bravo", Content: "some content"})
+		c := insert(t, ts.store, testUser, Todo{Title: "charlie", Content: "some content"})
+		if err := ts.store.DeleteTodo(ctx, a, testUser, 0, ScopeThis); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.store.DeleteTodo(ctx, b, otherUser, 0, ScopeThis); err != nil {
+			t.Fatal(err)
+		}
+
+		// nothing was trashed an hour ago
+		n, err := ts.store.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 || len(trashed(t, ts.store, testUser)) != 1 {
+			t.Errorf("%s: purged %d todos within the retention", ts.name, n)
+		}
+
+		// past the retention the trash of every user goes, the live todos stay
+		var wg sync.WaitGroup
+		stop, cancel := context.WithCancel(ctx)
+		StartTrashPurger(stop, &wg, ts.store, time.Nanosecond, time.Hour)
+		cancel()
+		wg.Wait()
+
+		if len(trashed(t, ts.store, testUser)) != 0 || len(trashed(t, ts.store, otherUser)) != 0 {
+			t.Errorf("%s: trash left after the purge", ts.name)
+		}
+		if got := live(t, ts.store, testUser); !slices.Equal(got, []int{c}) {
+			t.Errorf("%s: live %v after the purge, want %v", ts.name, got, []int{c})
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package todo
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"bytes"
+	"context"
+	"net/http"
+	"encoding/json"
+)
+
+const (
+	// reminderBatch is how many pending reminders are read at once
+	reminderBatch  = 100
+	webhookTimeout = 10 * time.Second
+)
+
+// Reminder is the event of a todo whose remind_at has come
+type Reminder struct {
+	Todo     Todo      `json:"todo"`
+	RemindAt time.Time `json:"remind_at"`
+}
+
+// Notifier delivers reminders, a reminder whose Notify fails is tried again
+// on the next run of the scheduler
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// NotifierFunc lets a plain function be a Notifier
+type NotifierFunc func(ctx context.Context, reminder Reminder) error
+
+func (f NotifierFunc) Notify(ctx context.Context, reminder Reminder) error {
+	return f(ctx, reminder)
+}
+
+// LogNotifier writes the reminders to the log
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	log.Printf("(LogNotifier) reminder of todo %d of user %d: %q\n", reminder.Todo.Id, reminder.Todo.UserId, reminder.Todo.Title)
+	return nil
+}
+
+// WebhookNotifier posts the reminders as json to URL, any answer but a 2xx
+// is a failed delivery
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %s", n.URL, res.Status)
+	}
+	return nil
+}
+
+// StartReminderScheduler delivers the reminders that have come through
+// notifier, it checks every interval until ctx is done and then calls
+// wg.Done. A reminder is marked
+// delivered only after Notify succeeds and the state lives in the store, so
+// delivery is at least once across restarts: a crash between the two, or
+// several schedulers on one database, can deliver a reminder twice.
+func StartReminderScheduler(ctx context.Context, wg *sync.WaitGroup, store TodoStore, notifier Notifier, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if n := sendReminders(ctx, store, notifier); n > 0 {
+				log.Printf("(StartReminderScheduler) delivered %d reminders\n", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sendReminders delivers the pending reminders and returns how many it
+// delivered, it stops at the first batch with a failure so a reminder that
+// keeps failing waits for the next run. It stops between two reminders when
+// ctx is done, a reminder it started is delivered and marked either way.
+func sendReminders(ctx context.Context, store TodoStore, notifier Notifier) int {
+	work := context.WithoutCancel(ctx)
+
+	sent := 0
+	for {
+		todos, err := store.PendingReminders(work, time.Now(), reminderBatch)
+		if err != nil {
+			log.Printf("(store.PendingReminders) Err: %v\n", err)
+			return sent
+		}
+
+		failed := false
+		for _, todo := range *todos {
+			if ctx.Err() != nil {
+				return sent
+			}
+
+			reminder := Reminder{Todo: todo, RemindAt: *todo.RemindAt}
+			if err := notifier.Notify(work, reminder); err != nil {
+				log.Printf("(notifier.Notify) todo %d: Err: %v\n", todo.Id, err)
+				failed = true
+				continue
+			}
+
+			if err := store.MarkReminded(work, todo.Id, reminder.RemindAt, time.Now()); err != nil {
+				log.Printf("(store.MarkReminded) Err: %v\n", err)
+				return sent
+			}
+			sent++
+		}
+
+		if failed || len(*todos) < reminderBatch {
+			return sent
+		}
+	}
+}
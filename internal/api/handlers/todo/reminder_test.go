@@ -0,0 +1,157 @@
+package todo
+
+import (
+	"io"
+	"log"
+	"time"
+	"errors"
+	"slices"
+	"context"
+	"testing"
+)
+
+// recorder is a Notifier that records the ids of the todos it is called
+// for, it fails while fail is set and calls before first when set
+type recorder struct {
+	ids    []int
+	fail   bool
+	before func(reminder Reminder)
+}
+
+func (r *recorder) Notify(ctx context.Context, reminder Reminder) error {
+	if r.before != nil {
+		r.before(reminder)
+	}
+	r.ids = append(r.ids, reminder.Todo.Id)
+	if r.fail {
+		return errors.New("notifier is down")
+	}
+	return nil
+}
+
+// pending lists the ids of the reminders due now
+func pending(t *testing.T, store TodoStore) []int {
+	t.Helper()
+
+	todos, err := store.PendingReminders(context.Background(), time.Now(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids(*todos)
+}
+
+// reminding is a todo reminding at remind
+func reminding(title string, remind time.Time) Todo {
+	return Todo{Title: title, Content: "some content", RemindAt: &remind}
+}
+
+func TestSendReminders(t *testing.T) {
+	// the failed deliveries are logged
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+		now := time.Now()
+
+		due   := insert(t, ts.store, testUser, reminding("Call the vet", now.Add(-time.Minute)))
+		later := insert(t, ts.store, testUser, reminding("Call the bank", now.Add(time.Hour)))
+		done  := insert(t, ts.store, testUser, reminding("Call mom", now.Add(-time.Hour)))
+		patch(t, ts.store, done, ScopeThis, func(todo *Todo) { todo.Done = true })
+
+		// a failed delivery stays pending
+		notifier := &recorder{fail: true}
+		if n := sendReminders(ctx, ts.store, notifier); n != 0 || !slices.Equal(notifier.ids, []int{due}) {
+			t.Errorf("%s: failing notifier sent %d of %v", ts.name, n, notifier.ids)
+		}
+		if got := pending(t, ts.store); !slices.Equal(got, []int{due}) {
+			t.Errorf("%s: pending %v after a failure, want %v", ts.name, got, []int{due})
+		}
+
+		// delivered and marked once
+		notifier = &recorder{}
+		if n := sendReminders(ctx, ts.store, notifier); n != 1 || !slices.Equal(notifier.ids, []int{due}) {
+			t.Errorf("%s: sent %d of %v, want %v", ts.name, n, notifier.ids, []int{due})
+		}
+		if n := sendReminders(ctx, ts.store, notifier); n != 0 || len(notifier.ids) != 1 {
+			t.Errorf("%s: sent %d again", ts.name, n)
+		}
+		todo, err := ts.store.GetTodoById(ctx, due, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.RemindedAt == nil {
+			t.Errorf("%s: delivered reminder not marked", ts.name)
+		}
+
+		// a new reminder time is a new reminder
+		patch(t, ts.store, later, ScopeThis, func(todo *Todo) {
+			remind := now.Add(-time.Second)
+			todo.RemindAt = &remind
+		})
+		if got := pending(t, ts.store); !slices.Equal(got, []int{later}) {
+			t.Errorf("%s: pending %v after a new reminder time, want %v", ts.name, got, []int{later})
+		}
+	}
+}
+
+// TestRemindAtChanged changes remind_at while its reminder is delivered,
+// the delivery does not mark the new reminder
+func TestRemindAtChanged(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+		now := time.Now()
+
+		id := insert(t, ts.store, testUser, reminding("Call the vet", now.Add(-time.Minute)))
+		notifier := &recorder{before: func(reminder Reminder) {
+			patch(t, ts.store, reminder.Todo.Id, ScopeThis, func(todo *Todo) {
+				remind := now.Add(-time.Second)
+				todo.RemindAt = &remind
+			})
+		}}
+		if n := sendReminders(ctx, ts.store, notifier); n != 1 {
+			t.Errorf("%s: sent %d", ts.name, n)
+		}
+		if got := pending(t, ts.store); !slices.Equal(got, []int{id}) {
+			t.Errorf("%s: pending %v, want the new reminder of %d", ts.name, got, id)
+		}
+	}
+}
+
+// TestMarkReminded matches remind_at as stored, to the microsecond, whatever
+// the precision and the location of the time it is given
+func TestMarkReminded(t *testing.T) {
+	remind := time.Date(2026, time.November, 2, 9, 0, 0, 123456789, time.UTC)
+	zone   := time.FixedZone("UTC+2", 2*60*60)
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		marked bool
+	}{
+		{"stored time", remind.Truncate(time.Microsecond), true},
+		{"nanoseconds", remind, true},
+		{"another location", remind.In(zone), true},
+		{"whole seconds", remind.Truncate(time.Second), false},
+		{"next microsecond", remind.Truncate(time.Microsecond).Add(time.Microsecond), false},
+	}
+
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		for _, tt := range tests {
+			id := insert(t, ts.store, testUser, reminding("Call the vet", remind))
+			if err := ts.store.MarkReminded(ctx, id, tt.at, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			todo, err := ts.store.GetTodoById(ctx, id, testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if marked := todo.RemindedAt != nil; marked != tt.marked {
+				t.Errorf("%s %s: marked %v, want %v", ts.name, tt.name, marked, tt.marked)
+			}
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package todo
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"strconv"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"todogin/internal/api/handlers"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// RegisterResourceHandlers registers the todo routes that name the todo in
+// the path, the successors of the routes of RegisterHandlers
+func RegisterResourceHandlers(router *gin.RouterGroup) {
+	router.GET("", getTodos)
+	router.POST("", postTodo)
+	router.GET("/trash", getTrash)
+	router.DELETE("/trash", emptyTrash)
+	router.GET("/search", searchTodos)
+	router.POST("/batch", batchTodos)
+	router.GET("/:id", getTodo)
+	router.PUT("/:id", putTodo)
+	router.PATCH("/:id", patchTodo)
+	router.DELETE("/:id", destroyTodo)
+	router.POST("/:id/restore", restoreTodoById)
+	router.GET("/:id/history", getTodoHistory)
+	router.POST("/:id/revert", revertTodo)
+	router.POST("/:id/move", moveTodo)
+	router.PUT("/:id/tags/:tag_id", tagTodo)
+	router.DELETE("/:id/tags/:tag_id", tagTodo)
+}
+
+func postTodo(c *gin.Context) {
+	var req TodoCreateReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	id, err := storage.InsertTodo(c.Request.Context(), req.draft(), userId)
+	if err != nil {
+		abortWithErr(c, "storage.InsertTodo", err)
+		return
+	}
+
+	todo, err := storage.GetTodoById(c.Request.Context(), id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTodoById", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg" : "todo creation success",
+			"todo": *todo,
+		},
+		nil,
+		errs,
+	)
+	c.Header("Location", path.Join(c.FullPath(), strconv.Itoa(id)))
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusCreated, resp)
+}
+
+func putTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	var req TodoPutReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	version, ok := requestVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	scope, ok := scopeQuery(c)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	todo, err := storage.PatchTodo(c.Request.Context(), userId, id, version, scope, req.patch)
+	if err != nil {
+		abortWithErr(c, "storage.PatchTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg" : "todo is updated",
+			"todo": *todo,
+		},
+		nil,
+		errs,
+	)
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusOK, resp)
+}
+
+func patchTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	patch, bodyVersion, ok := bindPatch(c)
+	if !ok {
+		return
+	}
+
+	version, ok := requestVersion(c, bodyVersion)
+	if !ok {
+		return
+	}
+
+	scope, ok := scopeQuery(c)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	todo, err := storage.PatchTodo(c.Request.Context(), userId, id, version, scope, func(todo *Todo) error {
+		return patchDoc(todo, patch)
+	})
+	if err != nil {
+		abortWithErr(c, "storage.PatchTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg" : "todo is updated",
+			"todo": *todo,
+		},
+		nil,
+		errs,
+	)
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusOK, resp)
+}
+
+// scopeQuery reads the scope of a change to a recurring todo from the query
+// string, it writes the 400 response and returns false when it is invalid
+func scopeQuery(c *gin.Context) (string, bool) {
+	var req TodoScopeQuery
+
+	if err := handlers.BindQuery(c, &req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return "", false
+	}
+	return req.Scope, true
+}
+
+// bindPatch reads the patch of a PATCH request by its content type, with
+// the version of a plain json body. It writes the 400 or 415 response and
+// returns false when the body is not a patch.
+func bindPatch(c *gin.Context) (docPatch, int, bool) {
+	var patch docPatch
+	var version int
+	var err error
+
+	switch c.ContentType() {
+	case "", binding.MIMEJSON:
+		var req TodoPatchReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errs, err := handlers.GetErrorMsgs(req, err)
+			resp := handlers.NewResp(
+				handlers.FAIL,
+				map[string]any{},
+				err,
+				errs,
+			)
+			c.JSON(http.StatusBadRequest, resp)
+			return nil, 0, false
+		}
+		patch, version = req.mergePatch(), req.Version
+	case mergePatchType, jsonPatchType:
+		var body []byte
+		body, err = c.GetRawData()
+		if err == nil && c.ContentType() == mergePatchType {
+			patch, err = parseMergePatch(body)
+		} else if err == nil {
+			patch, err = parseJSONPatch(body)
+		}
+	default:
+		errs := make(handlers.ErrsMap, 0)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			fmt.Errorf("unsupported content type %q", c.ContentType()),
+			errs,
+		)
+		c.Header("Accept-Patch", strings.Join([]string{binding.MIMEJSON, mergePatchType, jsonPatchType}, ", "))
+		c.JSON(http.StatusUnsupportedMediaType, resp)
+		return nil, 0, false
+	}
+
+	if err != nil {
+		errs := make(handlers.ErrsMap, 0)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			fmt.Errorf("invalid patch: %w", err),
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return nil, 0, false
+	}
+
+	return patch, version, true
+}
+
+func destroyTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	var req TodoVersionQuery
+
+	if err := handlers.BindQuery(c, &req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	version, ok := requestVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	err := storage.DeleteTodo(c.Request.Context(), id, userId, version, req.Scope)
+	if err != nil {
+		abortWithErr(c, "storage.DeleteTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "todo has moved to the trash",
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func moveTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	var req TodoMoveReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	version, ok := requestVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	targetId, after := 0, req.After != nil
+	if after {
+		targetId = *req.After
+	} else {
+		targetId = *req.Before
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	todo, err := storage.MoveTodo(c.Request.Context(), userId, id, version, targetId, after)
+	if err != nil {
+		abortWithErr(c, "storage.MoveTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg" : "todo has moved",
+			"todo": *todo,
+		},
+		nil,
+		errs,
+	)
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusOK, resp)
+}
+
+func restoreTodoById(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	err := storage.RestoreTodo(c.Request.Context(), id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.RestoreTodo", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "todo has restored",
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,137 @@
+package todo
+
+import (
+	"time"
+	"errors"
+	"encoding/json"
+	"database/sql/driver"
+)
+
+// revision actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionMove    = "move"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+)
+
+// Revision is one recorded change of a todo, with the state of the todo
+// right after the change
+type Revision struct {
+	Id        int       `json:"id"`
+	TodoId    int       `json:"todo_id"`
+	UserId    int       `json:"user_id"`
+	Action    string    `json:"action"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Done      bool      `json:"done"`
+	Changes   Changes   `json:"changes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Changes maps the changed todo fields (by json name) to their old and new value
+type Changes map[string]Change
+
+func (c Changes) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *Changes) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = Changes{}
+		return nil
+	}
+	return errors.New("Changes.Scan: unsupported type")
+}
+
+type TodoRevertReq struct {
+	RevisionId int `json:"revision_id" binding:"required,gte=1"`
+}
+
+// diffTodos returns the fields that differ between before and after,
+// a nil before is a todo that did not exist yet
+func diffTodos(before, after *Todo) Changes {
+	changes := make(Changes)
+	if before == nil {
+		changes["title"]   = Change{nil, after.Title}
+		changes["content"] = Change{nil, after.Content}
+		changes["done"]    = Change{nil, after.Done}
+		if after.DueAt != nil {
+			changes["due_at"] = Change{nil, after.DueAt}
+		}
+		if after.RemindAt != nil {
+			changes["remind_at"] = Change{nil, after.RemindAt}
+		}
+		if after.RRule != "" {
+			changes["rrule"] = Change{nil, after.RRule}
+		}
+		if after.Priority != PriorityNone {
+			changes["priority"] = Change{nil, after.Priority}
+		}
+		return changes
+	}
+
+	if before.Title != after.Title {
+		changes["title"] = Change{before.Title, after.Title}
+	}
+	if before.Content != after.Content {
+		changes["content"] = Change{before.Content, after.Content}
+	}
+	if before.Done != after.Done {
+		changes["done"] = Change{before.Done, after.Done}
+	}
+	if !sameTime(before.DueAt, after.DueAt) {
+		changes["due_at"] = Change{before.DueAt, after.DueAt}
+	}
+	if !sameTime(before.RemindAt, after.RemindAt) {
+		changes["remind_at"] = Change{before.RemindAt, after.RemindAt}
+	}
+	if before.RRule != after.RRule {
+		changes["rrule"] = Change{before.RRule, after.RRule}
+	}
+	if before.Priority != after.Priority {
+		changes["priority"] = Change{before.Priority, after.Priority}
+	}
+	if before.Position != after.Position {
+		changes["position"] = Change{before.Position, after.Position}
+	}
+	if (before.DeletedAt == nil) != (after.DeletedAt == nil) {
+		changes["deleted_at"] = Change{before.DeletedAt, after.DeletedAt}
+	}
+
+	return changes
+}
+
+// revert is the patch bringing a todo back to the title, content and done
+// of r
+func (r *Revision) revert(todo *Todo) error {
+	todo.Title, todo.Content, todo.Done = r.Title, r.Content, r.Done
+	return nil
+}
+
+// newRevision snapshots after as a revision of action made by userId
+func newRevision(action string, before, after *Todo, userId int, at time.Time) Revision {
+	return Revision{
+		TodoId   : after.Id,
+		UserId   : userId,
+		Action   : action,
+		Title    : after.Title,
+		Content  : after.Content,
+		Done     : after.Done,
+		Changes  : diffTodos(before, after),
+		CreatedAt: at,
+	}
+}
@@ -0,0 +1,97 @@
+package todo
+
+import (
+	"errors"
+	"slices"
+	"context"
+	"testing"
+	"todogin/internal/database"
+)
+
+// actions lists the actions of the history of a todo, newest first
+func actions(history []Revision) []string {
+	out := make([]string, len(history))
+	for i, revision := range history {
+		out[i] = revision.Action
+	}
+	return out
+}
+
+func TestRevertTodo(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		id := insert(t, ts.store, testUser, Todo{Title: "Walk the dog", Content: "around the block"})
+		patch(t, ts.store, id, ScopeThis, func(todo *Todo) { todo.Title, todo.Done = "Walk the cat", true })
+		patch(t, ts.store, id, ScopeThis, func(todo *Todo) { todo.Content = "to the park" })
+
+		history, err := ts.store.GetTodoHistory(ctx, id, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := actions(*history); !slices.Equal(got, []string{ActionUpdate, ActionUpdate, ActionCreate}) {
+			t.Fatalf("%s: history %v", ts.name, got)
+		}
+		if changes := (*history)[1].Changes; len(changes) != 2 || changes["title"].To != "Walk the cat" {
+			t.Errorf("%s: changes %v, want title and done", ts.name, changes)
+		}
+
+		created := (*history)[2].Id
+		if err := ts.store.RevertTodo(ctx, id, created, testUser); err != nil {
+			t.Fatal(err)
+		}
+		todo, err := ts.store.GetTodoById(ctx, id, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.Title != "Walk the dog" || todo.Content != "around the block" || todo.Done || todo.Version != 4 {
+			t.Errorf("%s: reverted to %+v", ts.name, todo)
+		}
+
+		history, err = ts.store.GetTodoHistory(ctx, id, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := (*history)[0]; got.Action != ActionRevert || got.Title != "Walk the dog" {
+			t.Errorf("%s: revert recorded as %s %q", ts.name, got.Action, got.Title)
+		}
+
+		other := insert(t, ts.store, testUser, Todo{Title: "Feed the fish", Content: "some content"})
+		if err := ts.store.RevertTodo(ctx, other, created, testUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: reverted to a revision of another todo: %v", ts.name, err)
+		}
+		if err := ts.store.RevertTodo(ctx, id, 9999, testUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: reverted to an unknown revision: %v", ts.name, err)
+		}
+		if err := ts.store.RevertTodo(ctx, id, created, otherUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: reverted the todo of another user: %v", ts.name, err)
+		}
+		if _, err := ts.store.GetTodoHistory(ctx, id, otherUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: history of the todo of another user: %v", ts.name, err)
+		}
+	}
+}
+
+// TestRevertOccurrence reverts an occurrence of a recurring todo to a done
+// revision, that completes it like a patch would and makes the next one
+func TestRevertOccurrence(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		draft := recurring("", 5)
+		id    := insert(t, ts.store, testUser, draft)
+		patch(t, ts.store, id, ScopeThis, done)
+		patch(t, ts.store, id, ScopeThis, func(todo *Todo) { todo.Done = false })
+		patch(t, ts.store, id, ScopeThis, func(todo *Todo) { todo.RRule = "FREQ=DAILY" })
+		checkOccurrences(t, ts, "recurring", "01-05 Water the plants")
+
+		history, err := ts.store.GetTodoHistory(ctx, id, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.store.RevertTodo(ctx, id, (*history)[2].Id, testUser); err != nil {
+			t.Fatal(err)
+		}
+		checkOccurrences(t, ts, "reverted to done", "01-05 Water the plants done", "01-06 Water the plants")
+	}
+}
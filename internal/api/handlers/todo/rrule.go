@@ -0,0 +1,476 @@
+package todo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"strconv"
+	"strings"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// frequencies of a rule
+const (
+	freqDaily   = "DAILY"
+	freqWeekly  = "WEEKLY"
+	freqMonthly = "MONTHLY"
+	freqYearly  = "YEARLY"
+)
+
+// maxPeriods bounds the search for the next instance of a rule, so a rule
+// that never matches (e.g. FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30) ends
+const maxPeriods = 10000
+
+// untilLayouts are the forms of UTC date times an UNTIL can take
+var untilLayouts = []string{"20060102T150405Z", "20060102T150405"}
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// RRule is the part of an RFC 5545 recurrence rule todos support: FREQ,
+// INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and WKST=MO. Rules are
+// expanded in the location of their start, which is always UTC for the
+// series: there is no TZID, a weekly rule keeps its UTC weekday and time
+// of day, not the one of the user.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      *time.Time
+	ByDay      []ByDay
+	ByMonthDay []int
+	ByMonth    []int
+}
+
+// ByDay is an item of BYDAY, N is the ordinal of the weekday in the month
+// or the year of a MONTHLY or YEARLY rule (-1FR is the last friday), 0 for
+// every such weekday
+type ByDay struct {
+	N   int
+	Day time.Weekday
+}
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		// an empty rule is no rule, the updates clear the rule with it
+		v.RegisterValidation("rrule", func(fl validator.FieldLevel) bool {
+			if fl.Field().String() == "" {
+				return true
+			}
+			_, err := ParseRRule(fl.Field().String())
+			return err == nil
+		})
+	}
+}
+
+// ParseRRule reads a rule like "FREQ=WEEKLY;BYDAY=MO,WE", with or without
+// the "RRULE:" prefix
+func ParseRRule(s string) (*RRule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("empty rrule")
+	}
+
+	r := &RRule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rrule has %s twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			if value != freqDaily && value != freqWeekly && value != freqMonthly && value != freqYearly {
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+			r.Freq = value
+		case "INTERVAL":
+			r.Interval, err = ruleInt(name, value, 1, 1000)
+		case "COUNT":
+			r.Count, err = ruleInt(name, value, 1, 10000)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = ruleInts(name, value, 31)
+		case "BYMONTH":
+			r.ByMonth, err = ruleInts(name, value, 12)
+			for _, m := range r.ByMonth {
+				if m < 0 {
+					return nil, fmt.Errorf("BYMONTH cannot be negative")
+				}
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return nil, fmt.Errorf("rrule needs a FREQ")
+	case r.Count > 0 && r.Until != nil:
+		return nil, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	case r.Freq == freqWeekly && len(r.ByMonthDay) > 0:
+		return nil, fmt.Errorf("BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	if r.Freq == freqDaily || r.Freq == freqWeekly {
+		for _, d := range r.ByDay {
+			if d.N != 0 {
+				return nil, fmt.Errorf("BYDAY ordinals need FREQ=MONTHLY or FREQ=YEARLY")
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// canonicalRule is the rule s written the way String writes it, so rules
+// compare as strings, s itself when it is not a valid rule
+func canonicalRule(s string) string {
+	if s == "" {
+		return s
+	}
+	r, err := ParseRRule(s)
+	if err != nil {
+		return s
+	}
+	return r.String()
+}
+
+func ruleInt(name, value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a number from %d to %d", name, min, max)
+	}
+	return n, nil
+}
+
+// ruleInts reads a list of numbers from 1 to max or -max to -1
+func ruleInts(name, value string, max int) ([]int, error) {
+	list := make([]int, 0)
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n == 0 || n < -max || n > max {
+			return nil, fmt.Errorf("%s takes numbers from 1 to %d or -%d to -1", name, max, max)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func parseUntil(value string) (*time.Time, error) {
+	for _, layout := range untilLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	// a date is inclusive, the rule runs to the end of that day
+	if d, err := time.Parse("20060102", value); err == nil {
+		until := d.Add(24*time.Hour - time.Second)
+		return &until, nil
+	}
+	return nil, fmt.Errorf("invalid UNTIL %q, use 20060102T150405Z", value)
+}
+
+func parseByDay(value string) ([]ByDay, error) {
+	days := make([]ByDay, 0)
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid BYDAY %q", item)
+		}
+		day := -1
+		for i, name := range weekdayNames {
+			if item[len(item)-2:] == name {
+				day = i
+			}
+		}
+		if day < 0 {
+			return nil, fmt.Errorf("invalid BYDAY %q", item)
+		}
+
+		n := 0
+		if ordinal := item[:len(item)-2]; ordinal != "" {
+			var err error
+			if n, err = strconv.Atoi(ordinal); err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid BYDAY %q", item)
+			}
+		}
+		days = append(days, ByDay{N: n, Day: time.Weekday(day)})
+	}
+	return days, nil
+}
+
+// String writes the rule back, its parts always in the same order
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayouts[0]))
+	}
+	if len(r.ByDay) > 0 {
+		items := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			items[i] = weekdayNames[d.Day]
+			if d.N != 0 {
+				items[i] = strconv.Itoa(d.N) + items[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(items, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts(list []int) string {
+	items := make([]string, len(list))
+	for i, n := range list {
+		items[i] = strconv.Itoa(n)
+	}
+	return strings.Join(items, ",")
+}
+
+// Next returns the first instance after after of the rule started at
+// start, start being its first instance as in RFC 5545, and false when the
+// rule has ended by then
+func (r *RRule) Next(start, after time.Time) (time.Time, bool) {
+	if start.After(after) {
+		return start, true
+	}
+
+	// without a COUNT the instances before after need not be counted
+	first := 0
+	if r.Count == 0 {
+		first = max(0, r.periodsTo(start, after)-1)
+	}
+
+	n := 1
+	for i := first; i < first+maxPeriods; i++ {
+		for _, t := range r.instances(start, i) {
+			if !t.After(start) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return time.Time{}, false
+			}
+			if n++; r.Count > 0 && n > r.Count {
+				return time.Time{}, false
+			}
+			if t.After(after) {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// periodsTo is how many periods of the rule (days, weeks, months or years
+// times INTERVAL) from start the period of t is
+func (r *RRule) periodsTo(start, t time.Time) int {
+	var n int
+	switch r.Freq {
+	case freqDaily:
+		n = daysBetween(dateOf(start), dateOf(t))
+	case freqWeekly:
+		n = daysBetween(weekOf(start), weekOf(t)) / 7
+	case freqMonthly:
+		n = (t.Year()-start.Year())*12 + int(t.Month()-start.Month())
+	case freqYearly:
+		n = t.Year() - start.Year()
+	}
+	return n / r.Interval
+}
+
+// instances lists in order the instances of the i-th period of the rule
+// started at start, at the time of day of start
+func (r *RRule) instances(start time.Time, i int) []time.Time {
+	y, m, d := start.Date()
+	clock := start.Sub(dateOf(start))
+	step  := i * r.Interval
+
+	var days []time.Time
+	switch r.Freq {
+	case freqDaily:
+		days = []time.Time{dateOf(start).AddDate(0, 0, step)}
+	case freqWeekly:
+		week := weekOf(start).AddDate(0, 0, 7*step)
+		if len(r.ByDay) == 0 {
+			days = []time.Time{week.AddDate(0, 0, mondayOffset(start.Weekday()))}
+		}
+		for _, bd := range r.ByDay {
+			days = append(days, week.AddDate(0, 0, mondayOffset(bd.Day)))
+		}
+	case freqMonthly:
+		days = r.monthDays(time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, start.Location()), d)
+	case freqYearly:
+		year := time.Date(y+step, time.January, 1, 0, 0, 0, 0, start.Location())
+		switch {
+		case len(r.ByMonth) > 0:
+			for _, month := range r.ByMonth {
+				days = append(days, r.monthDays(year.AddDate(0, month-1, 0), d)...)
+			}
+		case len(r.ByMonthDay) > 0:
+			for month := 0; month < 12; month++ {
+				days = append(days, r.monthDays(year.AddDate(0, month, 0), d)...)
+			}
+		case len(r.ByDay) > 0:
+			days = r.spanDays(year, year.AddDate(1, 0, 0))
+		default:
+			if day := year.AddDate(0, int(m)-1, d-1); day.Day() == d {
+				days = []time.Time{day}
+			}
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	instances := make([]time.Time, 0, len(days))
+	for i, day := range days {
+		if (i > 0 && day.Equal(days[i-1])) || !r.keeps(day) {
+			continue
+		}
+		instances = append(instances, day.Add(clock))
+	}
+	return instances
+}
+
+// monthDays lists the days BYMONTHDAY and BYDAY pick in the month starting
+// at first, or the day-th day when the rule has neither (none when the
+// month is too short)
+func (r *RRule) monthDays(first time.Time, day int) []time.Time {
+	next := first.AddDate(0, 1, 0)
+	n    := daysBetween(first, next)
+
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if day > n {
+			return nil
+		}
+		return []time.Time{first.AddDate(0, 0, day-1)}
+	}
+	if len(r.ByMonthDay) == 0 {
+		return r.spanDays(first, next)
+	}
+
+	var picked map[time.Time]bool
+	if len(r.ByDay) > 0 {
+		picked = make(map[time.Time]bool)
+		for _, day := range r.spanDays(first, next) {
+			picked[day] = true
+		}
+	}
+
+	days := make([]time.Time, 0)
+	for _, md := range r.ByMonthDay {
+		if md < 0 {
+			md += n + 1
+		}
+		if md < 1 || md > n {
+			continue
+		}
+		if day := first.AddDate(0, 0, md-1); picked == nil || picked[day] {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// spanDays lists the days BYDAY picks from first up to end, an ordinal
+// counts within the span
+func (r *RRule) spanDays(first, end time.Time) []time.Time {
+	n    := daysBetween(first, end)
+	days := make([]time.Time, 0)
+	for _, bd := range r.ByDay {
+		// offset of the first such weekday in the span
+		offset := (int(bd.Day) - int(first.Weekday()) + 7) % 7
+		count  := (n - offset + 6) / 7
+		switch {
+		case bd.N == 0:
+			for k := 0; k < count; k++ {
+				days = append(days, first.AddDate(0, 0, offset+7*k))
+			}
+		case bd.N > 0 && bd.N <= count:
+			days = append(days, first.AddDate(0, 0, offset+7*(bd.N-1)))
+		case bd.N < 0 && -bd.N <= count:
+			days = append(days, first.AddDate(0, 0, offset+7*(count+bd.N)))
+		}
+	}
+	return days
+}
+
+// keeps reports whether the BYMONTH, BYMONTHDAY and BYDAY parts that limit
+// rather than expand the instances of the rule let day through
+func (r *RRule) keeps(day time.Time) bool {
+	if len(r.ByMonth) > 0 && r.Freq != freqYearly && !containsInt(r.ByMonth, int(day.Month())) {
+		return false
+	}
+	if r.Freq != freqDaily {
+		return true
+	}
+
+	if len(r.ByMonthDay) > 0 {
+		n := daysBetween(day.AddDate(0, 0, 1-day.Day()), day.AddDate(0, 1, 1-day.Day()))
+		if !containsInt(r.ByMonthDay, day.Day()) && !containsInt(r.ByMonthDay, day.Day()-n-1) {
+			return false
+		}
+	}
+	if len(r.ByDay) > 0 {
+		for _, bd := range r.ByDay {
+			if bd.Day == day.Weekday() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// dateOf is the start of the day of t
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// weekOf is the start of the monday of the week of t
+func weekOf(t time.Time) time.Time {
+	return dateOf(t).AddDate(0, 0, -mondayOffset(t.Weekday()))
+}
+
+// mondayOffset is how many days after monday day comes
+func mondayOffset(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+func daysBetween(a, b time.Time) int {
+	return int(b.Sub(a).Round(time.Hour).Hours()) / 24
+}
@@ -0,0 +1,149 @@
+package todo
+
+import (
+	"time"
+	"slices"
+	"testing"
+)
+
+// expand lists the first n instances of rule started at start
+func expand(t *testing.T, rule string, start time.Time, n int) []string {
+	t.Helper()
+
+	r, err := ParseRRule(rule)
+	if err != nil {
+		t.Fatalf("%s: %v", rule, err)
+	}
+
+	out   := make([]string, 0)
+	after := start.Add(-time.Second)
+	for len(out) < n {
+		next, ok := r.Next(start, after)
+		if !ok {
+			break
+		}
+		out   = append(out, next.Format("2006-01-02 15:04"))
+		after = next
+	}
+	return out
+}
+
+func TestRRuleNext(t *testing.T) {
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []string
+	}{
+		{"daily interval", "FREQ=DAILY;INTERVAL=3;COUNT=4", at(2026, 1, 30), []string{"2026-01-30 09:30", "2026-02-02 09:30", "2026-02-05 09:30", "2026-02-08 09:30"}},
+		{"weekly interval skips weeks", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", at(2026, 1, 5), []string{"2026-01-05 09:30", "2026-01-09 09:30", "2026-01-19 09:30", "2026-01-23 09:30", "2026-02-02 09:30"}},
+		{"weekly on the start weekday", "FREQ=WEEKLY", at(2026, 1, 1), []string{"2026-01-01 09:30", "2026-01-08 09:30", "2026-01-15 09:30"}},
+		{"daily limited by weekday", "FREQ=DAILY;BYDAY=MO,WE", at(2026, 1, 5), []string{"2026-01-05 09:30", "2026-01-07 09:30", "2026-01-12 09:30"}},
+		{"last friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", at(2026, 1, 30), []string{"2026-01-30 09:30", "2026-02-27 09:30", "2026-03-27 09:30", "2026-04-24 09:30"}},
+		{"second tuesday of the month", "FREQ=MONTHLY;BYDAY=2TU", at(2026, 1, 13), []string{"2026-01-13 09:30", "2026-02-10 09:30", "2026-03-10 09:30"}},
+		{"last friday of the year", "FREQ=YEARLY;BYDAY=-1FR", at(2026, 12, 25), []string{"2026-12-25 09:30", "2027-12-31 09:30", "2028-12-29 09:30"}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", at(2026, 1, 31), []string{"2026-01-31 09:30", "2026-02-28 09:30", "2026-03-31 09:30", "2026-04-30 09:30"}},
+		{"second to last day in a leap year", "FREQ=MONTHLY;BYMONTHDAY=-2", at(2028, 2, 28), []string{"2028-02-28 09:30", "2028-03-30 09:30", "2028-04-29 09:30"}},
+		{"31st skips the short months", "FREQ=MONTHLY", at(2026, 1, 31), []string{"2026-01-31 09:30", "2026-03-31 09:30", "2026-05-31 09:30", "2026-07-31 09:30"}},
+		{"30th skips february", "FREQ=MONTHLY", at(2026, 1, 30), []string{"2026-01-30 09:30", "2026-03-30 09:30", "2026-04-30 09:30"}},
+		{"29th to 31st", "FREQ=MONTHLY;BYMONTHDAY=29,30,31", at(2026, 1, 29), []string{"2026-01-29 09:30", "2026-01-30 09:30", "2026-01-31 09:30", "2026-03-29 09:30"}},
+		{"february 29th in leap years", "FREQ=YEARLY", at(2024, 2, 29), []string{"2024-02-29 09:30", "2028-02-29 09:30", "2032-02-29 09:30"}},
+		{"yearly by month", "FREQ=YEARLY;BYMONTH=1,7;BYMONTHDAY=1", at(2026, 1, 1), []string{"2026-01-01 09:30", "2026-07-01 09:30", "2027-01-01 09:30"}},
+	}
+
+	for _, tt := range tests {
+		if got := expand(t, tt.rule, tt.start, len(tt.want)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %s got %v, want %v", tt.name, tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestRRuleEnds(t *testing.T) {
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []string
+	}{
+		{"count counts the start", "FREQ=DAILY;COUNT=3", at(2026, 1, 30), []string{"2026-01-30 09:30", "2026-01-31 09:30", "2026-02-01 09:30"}},
+		{"until is inclusive", "FREQ=DAILY;UNTIL=20260201T093000Z", at(2026, 1, 30), []string{"2026-01-30 09:30", "2026-01-31 09:30", "2026-02-01 09:30"}},
+		{"until date runs to the end of the day", "FREQ=DAILY;UNTIL=20260131", at(2026, 1, 30), []string{"2026-01-30 09:30", "2026-01-31 09:30"}},
+		{"a rule that never matches ends", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", at(2026, 2, 28), []string{"2026-02-28 09:30"}},
+		{"count after an interval", "FREQ=WEEKLY;INTERVAL=2;COUNT=2", at(2026, 1, 5), []string{"2026-01-05 09:30", "2026-01-19 09:30"}},
+	}
+
+	for _, tt := range tests {
+		if got := expand(t, tt.rule, tt.start, 10); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %s got %v, want %v", tt.name, tt.rule, got, tt.want)
+		}
+	}
+}
+
+// TestRRuleNextFar checks that a rule without COUNT skips the periods
+// before after rather than walking them
+func TestRRuleNextFar(t *testing.T) {
+	r, err := ParseRRule("FREQ=DAILY;INTERVAL=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, time.January, 1, 9, 30, 0, 0, time.UTC)
+	next, ok := r.Next(start, time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2026, time.March, 2, 9, 30, 0, 0, time.UTC); !ok || !next.Equal(want) {
+		t.Errorf("got %v %v, want %v", next, ok, want)
+	}
+
+	next, ok = r.Next(start, time.Date(2126, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2126, time.January, 2, 9, 30, 0, 0, time.UTC); !ok || !next.Equal(want) {
+		t.Errorf("a century on got %v %v, want %v", next, ok, want)
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	valid := map[string]string{
+		"FREQ=DAILY"                                : "FREQ=DAILY",
+		"rrule:freq=weekly;byday=mo,we;interval=1"  : "FREQ=WEEKLY;BYDAY=MO,WE",
+		"FREQ=MONTHLY;BYDAY=-1FR;WKST=MO;COUNT=5"   : "FREQ=MONTHLY;COUNT=5;BYDAY=-1FR",
+		"FREQ=YEARLY;UNTIL=20300101T000000Z"        : "FREQ=YEARLY;UNTIL=20300101T000000Z",
+	}
+	for rule, want := range valid {
+		r, err := ParseRRule(rule)
+		if err != nil {
+			t.Errorf("%s: %v", rule, err)
+			continue
+		}
+		if r.String() != want {
+			t.Errorf("%s: written as %s, want %s", rule, r.String(), want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"BYDAY=MO",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;FREQ=DAILY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20300101",
+		"FREQ=WEEKLY;BYDAY=-1FR",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=YEARLY;BYMONTH=-1",
+		"FREQ=DAILY;WKST=SU",
+		"FREQ=DAILY;BYSETPOS=1",
+	}
+	for _, rule := range invalid {
+		if _, err := ParseRRule(rule); err == nil {
+			t.Errorf("%q parsed", rule)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package todo
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"todogin/internal/database"
+)
+
+// snippet highlighting
+const (
+	markStart = "<mark>"
+	markEnd   = "</mark>"
+	// snippetWords is how many words a snippet built in Go keeps
+	snippetWords = 16
+)
+
+// SearchHit is a todo found by SearchTodos
+type SearchHit struct {
+	Todo    Todo    `json:"todo"`
+	// Rank orders the hits of one search, higher is more relevant. Its scale
+	// depends on the backend, don't compare it across searches.
+	Rank    float64 `json:"rank"`
+	// Snippet is the matching part of the todo, with the terms in <mark>
+	Snippet string  `json:"snippet"`
+}
+
+func (h *SearchHit) Fields() database.Fields {
+	fields := h.Todo.Fields()
+	fields["rank"]    = &h.Rank
+	fields["snippet"] = &h.Snippet
+	return fields
+}
+
+type TodoSearchReq struct {
+	Q      string `form:"q" binding:"required,max=100"`
+	Limit  int    `form:"limit" binding:"gte=0,lte=100"`
+	Offset int    `form:"offset" binding:"gte=0"`
+}
+
+// searchTerms splits a search text into lower case words, every one of
+// them must match for a todo to be found
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesTerm reports whether word matches a search term, words are
+// matched by prefix so "walk" finds "walking"
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// wordSpan is the byte range of a word in a text
+type wordSpan struct {
+	start, end int
+}
+
+func wordSpans(text string) []wordSpan {
+	spans := make([]wordSpan, 0)
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, wordSpan{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, wordSpan{start, len(text)})
+	}
+	return spans
+}
+
+// countMatches counts the words of text matching terms, it is 0 unless
+// every term matches at least once
+func countMatches(text string, terms []string) int {
+	total, seen := 0, make(map[string]bool)
+	for _, span := range wordSpans(text) {
+		word := strings.ToLower(text[span.start:span.end])
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				seen[term] = true
+				total++
+			}
+		}
+	}
+	if len(seen) < len(terms) {
+		return 0
+	}
+	return total
+}
+
+// highlight returns the snippetWords words of text around the first match
+// of terms, with the matching words wrapped in <mark>
+func highlight(text string, terms []string) string {
+	spans := wordSpans(text)
+	if len(spans) == 0 {
+		return ""
+	}
+
+	first := 0
+	for i, span := range spans {
+		if matchesTerm(text[span.start:span.end], terms) {
+			first = i
+			break
+		}
+	}
+
+	from := first - snippetWords/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetWords
+	if to > len(spans) {
+		to = len(spans)
+	}
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("...")
+	}
+	pos := spans[from].start
+	for _, span := range spans[from:to] {
+		sb.WriteString(text[pos:span.start])
+		word := text[span.start:span.end]
+		if matchesTerm(word, terms) {
+			sb.WriteString(markStart + word + markEnd)
+		} else {
+			sb.WriteString(word)
+		}
+		pos = span.end
+	}
+	if to < len(spans) {
+		sb.WriteString("...")
+	}
+
+	return sb.String()
+}
+
+// snippetOf highlights the content of todo, or its title when only the
+// title matches
+func snippetOf(todo Todo, terms []string) string {
+	if countMatches(todo.Content, terms) == 0 && countMatches(todo.Title, terms) > 0 {
+		return highlight(todo.Title, terms)
+	}
+	return highlight(todo.Content, terms)
+}
+
+// memoryRank scores todo for the memory storage, 0 when it does not match.
+// Every term must match the title or the content, title hits weigh double.
+func memoryRank(todo Todo, terms []string) float64 {
+	if countMatches(todo.Title+" "+todo.Content, terms) == 0 {
+		return 0
+	}
+
+	score := 0.0
+	for _, term := range terms {
+		score += 2*float64(countMatches(todo.Title, []string{term})) + float64(countMatches(todo.Content, []string{term}))
+	}
+	return score
+}
+
+// the match expressions below require every term as a word prefix, the
+// terms are plain lower case words so none of them reads as an operator
+
+// ftsQuery builds a sqlite fts4 match expression
+func ftsQuery(terms []string) string {
+	return joinTerms(terms, "", "*", " ")
+}
+
+// mysqlQuery builds a mysql boolean mode against expression
+func mysqlQuery(terms []string) string {
+	return joinTerms(terms, "+", "*", " ")
+}
+
+// postgresQuery builds a postgres to_tsquery expression
+func postgresQuery(terms []string) string {
+	return joinTerms(terms, "", ":*", " & ")
+}
+
+func joinTerms(terms []string, prefix, suffix, sep string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = prefix + term + suffix
+	}
+	return strings.Join(parts, sep)
+}
+
+// rankHits orders hits by rank, then id, and returns the limit ones after offset
+func rankHits(hits []SearchHit, limit, offset int) []SearchHit {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].Todo.Id < hits[j].Todo.Id
+	})
+
+	if offset >= len(hits) {
+		return make([]SearchHit, 0)
+	}
+	hits = hits[offset:]
+	if limit < len(hits) {
+		hits = hits[:limit]
+	}
+	return hits
+}
@@ -0,0 +1,67 @@
+package todo
+
+import (
+	"slices"
+	"context"
+	"testing"
+)
+
+func TestSearchTodos(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		dog     := insert(t, ts.store, testUser, Todo{Title: "Walk the dog", Content: "a daily errand"})
+		store   := insert(t, ts.store, testUser, Todo{Title: "Errands", Content: "walk to the store for milk"})
+		walking := insert(t, ts.store, testUser, Todo{Title: "Exercise", Content: "go walking in the park"})
+		insert(t, ts.store, otherUser, Todo{Title: "Walk the cat", Content: "someone else's todo"})
+		trashed := insert(t, ts.store, testUser, Todo{Title: "Walk in the trash", Content: "a deleted todo"})
+		if err := ts.store.DeleteTodo(ctx, trashed, testUser, 0, ScopeThis); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name     string
+			q        string
+			limit    int
+			offset   int
+			want     []int
+			snippets []string
+		}{
+			// a title hit weighs double, the ties go by id
+			{"ranked", "walk", 10, 0, []int{dog, store, walking}, []string{"<mark>Walk</mark> the dog", "<mark>walk</mark> to the store for milk", "go <mark>walking</mark> in the park"}},
+			{"word prefix", "wal", 10, 0, []int{dog, store, walking}, nil},
+			{"every term", "walk milk", 10, 0, []int{store}, []string{"<mark>walk</mark> to the store for <mark>milk</mark>"}},
+			{"ignores case", "ERRAND", 10, 0, []int{store, dog}, nil},
+			{"paged", "walk", 1, 1, []int{store}, nil},
+			{"no match", "zebra", 10, 0, []int{}, nil},
+			{"no terms", "!!", 10, 0, []int{}, nil},
+		}
+
+		for _, tt := range tests {
+			hits, err := ts.store.SearchTodos(ctx, testUser, tt.q, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("%s %s: %v", ts.name, tt.name, err)
+			}
+
+			got := make([]int, 0)
+			for _, hit := range *hits {
+				got = append(got, hit.Todo.Id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s %s: found %v, want %v", ts.name, tt.name, got, tt.want)
+				continue
+			}
+
+			for i, snippet := range tt.snippets {
+				if (*hits)[i].Snippet != snippet {
+					t.Errorf("%s %s: snippet %q, want %q", ts.name, tt.name, (*hits)[i].Snippet, snippet)
+				}
+			}
+			for i := 1; i < len(*hits); i++ {
+				if (*hits)[i].Rank > (*hits)[i-1].Rank {
+					t.Errorf("%s %s: hits not ordered by rank", ts.name, tt.name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package todo
+
+import (
+	"fmt"
+	"time"
+	"net/http"
+	"todogin/internal/api/handlers"
+)
+
+// scopes of a change to an occurrence of a recurring todo
+const (
+	ScopeThis   = "this"
+	ScopeFuture = "future"
+)
+
+// Series is the template the occurrences of a recurring todo are made
+// from, the next occurrence is made when one is done or skipped
+type Series struct {
+	Id           int
+	UserId       int
+	Title        string
+	Content      string
+	RRule        string
+	Priority     int
+	// StartAt is the DTSTART of RRule, the due time the rule starts from
+	StartAt      time.Time
+	// RemindBefore is how many seconds before it is due an occurrence
+	// reminds, nil for no reminder
+	RemindBefore *int
+	// EndedAt is when the series stopped making occurrences
+	EndedAt      *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// newSeries is the series todo starts when it gets its first rrule, it is
+// the first occurrence
+func newSeries(todo *Todo, now time.Time) Series {
+	series := Series{UserId: todo.UserId, StartAt: *todo.DueAt, CreatedAt: now}
+	series.follow(todo, now)
+	return series
+}
+
+// follow makes todo the template of the occurrences to come
+func (s *Series) follow(todo *Todo, now time.Time) {
+	s.Title, s.Content, s.RRule = todo.Title, todo.Content, todo.RRule
+	s.Priority = todo.Priority
+	s.RemindBefore = nil
+	if todo.DueAt != nil && todo.RemindAt != nil {
+		before := int(todo.DueAt.Sub(*todo.RemindAt) / time.Second)
+		s.RemindBefore = &before
+	}
+	s.UpdatedAt = now
+}
+
+// next is the draft of the occurrence after the one at at, false when
+// the series has ended
+func (s *Series) next(at time.Time) (Todo, bool) {
+	if s.EndedAt != nil {
+		return Todo{}, false
+	}
+	rule, err := ParseRRule(s.RRule)
+	if err != nil {
+		return Todo{}, false
+	}
+	due, ok := rule.Next(s.StartAt, at)
+	if !ok {
+		return Todo{}, false
+	}
+
+	todo := Todo{
+		Title       : s.Title,
+		Content     : s.Content,
+		DueAt       : &due,
+		RemindAt    : s.remindAt(due),
+		RRule       : s.RRule,
+		SeriesId    : &s.Id,
+		RecurrenceAt: &due,
+		Priority    : s.Priority,
+	}
+	return todo, true
+}
+
+// remindAt is the reminder time of an occurrence due at due
+func (s *Series) remindAt(due time.Time) *time.Time {
+	if s.RemindBefore == nil {
+		return nil
+	}
+	remind := due.Add(-time.Duration(*s.RemindBefore) * time.Second)
+	return &remind
+}
+
+// edit applies to s the change of its occurrence from before to after made
+// with scope=future, it reports whether the occurrences made by the old
+// template after this one are dropped: the series ended, or its rule starts
+// over at after
+func (s *Series) edit(before, after *Todo, now time.Time) bool {
+	s.follow(after, now)
+	if after.RRule == "" {
+		s.EndedAt = &now
+		return true
+	}
+
+	s.EndedAt = nil
+	if after.RRule != before.RRule || !sameTime(before.DueAt, after.DueAt) {
+		s.StartAt = *after.DueAt
+		after.RecurrenceAt = after.DueAt
+		return true
+	}
+	return false
+}
+
+// follows makes todo, a later occurrence of s made by its template, follow
+// the current template
+func (s *Series) follows(todo *Todo) error {
+	todo.Title, todo.Content, todo.Priority = s.Title, s.Content, s.Priority
+	todo.RemindAt = s.remindAt(*todo.DueAt)
+	return nil
+}
+
+// checkRecurrence validates the change of a todo from before to after made
+// with scope, the errors are *PatchError
+func checkRecurrence(before, after *Todo, scope string) error {
+	if after.RRule != "" {
+		if _, err := ParseRRule(after.RRule); err != nil {
+			errs := handlers.ErrsMap{"rrule": {"rrule": err.Error()}}
+			return &PatchError{http.StatusUnprocessableEntity, err, errs}
+		}
+		if after.DueAt == nil {
+			return &PatchError{http.StatusUnprocessableEntity, fmt.Errorf("a recurring todo needs a due_at"), nil}
+		}
+	}
+
+	if before != nil && before.SeriesId != nil && scope != ScopeFuture && after.RRule != before.RRule {
+		return &PatchError{http.StatusUnprocessableEntity, fmt.Errorf("the rrule of a recurring todo changes with scope=future"), nil}
+	}
+	return nil
+}
+
+// completes reports whether the change from before to after is an
+// occurrence of a series getting done
+func completes(before, after *Todo) bool {
+	return after.SeriesId != nil && after.RecurrenceAt != nil && !before.Done && after.Done
+}
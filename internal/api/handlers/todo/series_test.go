@@ -0,0 +1,149 @@
+package todo
+
+import (
+	"time"
+	"errors"
+	"slices"
+	"context"
+	"testing"
+	"net/http"
+)
+
+// occurrences lists the live todos of the test user as "due title", with
+// " done" when done, in the order they were made
+func occurrences(t *testing.T, store TodoStore) []string {
+	t.Helper()
+
+	todos, err := store.GetTodos(context.Background(), testUser, ListQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, 0)
+	for _, todo := range *todos {
+		line := todo.DueAt.UTC().Format("01-02") + " " + todo.Title
+		if todo.Done {
+			line += " done"
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// last is the id of the todo of the test user made last
+func last(t *testing.T, store TodoStore) int {
+	t.Helper()
+
+	todos, err := store.GetTodos(context.Background(), testUser, ListQuery{Limit: 100})
+	if err != nil || len(*todos) == 0 {
+		t.Fatalf("no todos: %v", err)
+	}
+	return (*todos)[len(*todos)-1].Id
+}
+
+func patch(t *testing.T, store TodoStore, id int, scope string, change func(todo *Todo)) {
+	t.Helper()
+
+	_, err := store.PatchTodo(context.Background(), testUser, id, 0, scope, func(todo *Todo) error {
+		change(todo)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkOccurrences(t *testing.T, ts testStore, step string, want ...string) {
+	t.Helper()
+
+	if got := occurrences(t, ts.store); !slices.Equal(got, want) {
+		t.Errorf("%s %s: occurrences %v, want %v", ts.name, step, got, want)
+	}
+}
+
+func recurring(rule string, day int) Todo {
+	due := time.Date(2026, time.January, day, 9, 0, 0, 0, time.UTC)
+	return Todo{Title: "Water the plants", Content: "with the green can", DueAt: &due, RRule: rule}
+}
+
+func done(todo *Todo) { todo.Done = true }
+
+// TestSeriesThis changes single occurrences: done or deleted, the next
+// one is made from the series, unchanged by the edits of this one
+func TestSeriesThis(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		first := insert(t, ts.store, testUser, recurring("FREQ=DAILY;COUNT=3", 5))
+		patch(t, ts.store, first, ScopeThis, done)
+		checkOccurrences(t, ts, "first done", "01-05 Water the plants done", "01-06 Water the plants")
+
+		second := last(t, ts.store)
+		patch(t, ts.store, second, ScopeThis, func(todo *Todo) { todo.Title = "Water the ferns" })
+		if err := ts.store.DeleteTodo(ctx, second, testUser, 0, ScopeThis); err != nil {
+			t.Fatal(err)
+		}
+		checkOccurrences(t, ts, "second skipped", "01-05 Water the plants done", "01-07 Water the plants")
+
+		// the rule has run its COUNT
+		patch(t, ts.store, last(t, ts.store), ScopeThis, done)
+		checkOccurrences(t, ts, "third done", "01-05 Water the plants done", "01-07 Water the plants done")
+
+		// done again makes no second copy of the next occurrence
+		patch(t, ts.store, first, ScopeThis, func(todo *Todo) { todo.Done = false })
+		patch(t, ts.store, first, ScopeThis, done)
+		checkOccurrences(t, ts, "first done again", "01-05 Water the plants done", "01-07 Water the plants done")
+
+		_, err := ts.store.PatchTodo(ctx, testUser, first, 0, ScopeThis, func(todo *Todo) error {
+			todo.RRule = "FREQ=WEEKLY"
+			return nil
+		})
+		var perr *PatchError
+		if !errors.As(err, &perr) || perr.Status != http.StatusUnprocessableEntity {
+			t.Errorf("%s: rrule changed without scope=future: %v", ts.name, err)
+		}
+	}
+}
+
+// TestSeriesFuture changes an occurrence and the ones after it
+func TestSeriesFuture(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		first := insert(t, ts.store, testUser, recurring("FREQ=WEEKLY", 5))
+		patch(t, ts.store, first, ScopeThis, done)
+		second := last(t, ts.store)
+
+		// the later occurrence follows the new template
+		patch(t, ts.store, first, ScopeFuture, func(todo *Todo) { todo.Title = "Water the ferns" })
+		checkOccurrences(t, ts, "renamed", "01-05 Water the ferns done", "01-12 Water the ferns")
+
+		// a new rule starts over from the occurrence it is set on
+		patch(t, ts.store, second, ScopeFuture, func(todo *Todo) { todo.RRule = "FREQ=WEEKLY;BYDAY=FR" })
+		patch(t, ts.store, second, ScopeThis, done)
+		checkOccurrences(t, ts, "new rule", "01-05 Water the ferns done", "01-12 Water the ferns done", "01-16 Water the ferns")
+
+		// an empty rule ends the series and drops the occurrences after it
+		patch(t, ts.store, second, ScopeFuture, func(todo *Todo) { todo.RRule = "" })
+		checkOccurrences(t, ts, "ended", "01-05 Water the ferns done", "01-12 Water the ferns done")
+
+		patch(t, ts.store, second, ScopeThis, func(todo *Todo) { todo.Done = false })
+		patch(t, ts.store, second, ScopeThis, done)
+		checkOccurrences(t, ts, "done after the end", "01-05 Water the ferns done", "01-12 Water the ferns done")
+
+		// deleting with scope=future trashes the occurrence and the ones after it
+		other := insert(t, ts.store, testUser, recurring("FREQ=DAILY", 20))
+		patch(t, ts.store, other, ScopeThis, done)
+		if err := ts.store.DeleteTodo(ctx, other, testUser, 0, ScopeFuture); err != nil {
+			t.Fatal(err)
+		}
+		checkOccurrences(t, ts, "deleted", "01-05 Water the ferns done", "01-12 Water the ferns done")
+
+		trash, err := ts.store.GetTrash(ctx, testUser, ListQuery{Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*trash) != 3 {
+			t.Errorf("%s: %d todos in the trash, want 3", ts.name, len(*trash))
+		}
+	}
+}
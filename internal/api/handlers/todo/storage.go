@@ -1,44 +1,337 @@
 package todo
 
 import (
+	"fmt"
+	"time"
 	"errors"
+	"slices"
+	"context"
 	"database/sql"
 	"github.com/gin-gonic/gin"
 	"todogin/internal/database"
 )
 
+// TodoStore is what the todo handlers need from a storage backend
+type TodoStore interface {
+	// InsertTodo saves draft as a new todo of the user, only the fields a
+	// PatchTodo patch can set are read from it
+	InsertTodo(ctx context.Context, draft Todo, userId int) (int, error)
+	GetTodos(ctx context.Context, userId int, q ListQuery) (*[]Todo, error)
+	GetTodoById(ctx context.Context, id, userId int) (*Todo, error)
+	// GetTotalTodoCount counts the todos of the user that pass f
+	GetTotalTodoCount(ctx context.Context, userId int, f ListFilter) (int, error)
+	// PatchTodo changes a todo and returns it, a non zero version must match
+	// the current one or a *StaleError is returned. patch gets a copy of the
+	// todo, locked until the change is saved, and sets the fields to change
+	// (title, content, done, ...). An error from patch cancels the change, patch
+	// must not call the store. The change of an occurrence of a recurring
+	// todo with scope ScopeFuture also changes the occurrences to come, and
+	// an occurrence getting done makes the next one.
+	PatchTodo(ctx context.Context, userId int, todoId int, version int, scope string, patch func(todo *Todo) error) (*Todo, error)
+	// DeleteTodo moves the todo to the trash, version works as in PatchTodo.
+	// Deleting an occurrence of a recurring todo skips to the next one, or
+	// ends the series with scope ScopeFuture.
+	DeleteTodo(ctx context.Context, id, userId int, version int, scope string) error
+	GetTrash(ctx context.Context, userId int, q ListQuery) (*[]Todo, error)
+	RestoreTodo(ctx context.Context, id, userId int) error
+	// EmptyTrash permanently deletes the trashed todos of the user
+	EmptyTrash(ctx context.Context, userId int) (int, error)
+	// PurgeTrash permanently deletes the todos of every user trashed before t
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	// GetTodoHistory lists the revisions of a todo, newest first
+	GetTodoHistory(ctx context.Context, id, userId int) (*[]Revision, error)
+	// RevertTodo brings a todo back to the title, content and done of one
+	// of its revisions, a change like a PatchTodo of them with ScopeThis
+	RevertTodo(ctx context.Context, id, revisionId, userId int) error
+	// SearchTodos finds the live todos of the user whose title or content
+	// match every word of q, most relevant first
+	SearchTodos(ctx context.Context, userId int, q string, limit, offset int) (*[]SearchHit, error)
+	// BatchTodos runs ops in one transaction and returns a result per op. An
+	// atomic batch stops at the first failing op and saves none of them,
+	// otherwise every op is saved or rolled back on its own.
+	BatchTodos(ctx context.Context, userId int, ops []BatchOp, atomic bool) ([]BatchResult, error)
+	// PendingReminders lists the live todos of every user, not done, whose
+	// remind_at has come at now and whose reminder is not delivered yet,
+	// oldest reminder first
+	PendingReminders(ctx context.Context, now time.Time, limit int) (*[]Todo, error)
+	// MarkReminded records the delivery at at of the reminder of a todo set
+	// for remindAt, it does nothing when remind_at has changed since
+	MarkReminded(ctx context.Context, id int, remindAt time.Time, at time.Time) error
+	// MoveTodo places a todo right before the live todo targetId in the
+	// list, or right after it, version works as in PatchTodo. Only the
+	// moved todo changes unless the positions around the target ran out.
+	MoveTodo(ctx context.Context, userId int, todoId int, version int, targetId int, after bool) (*Todo, error)
+	// GetTags lists the tags of the user by name, with their todo counts
+	GetTags(ctx context.Context, userId int) (*[]Tag, error)
+	GetTagById(ctx context.Context, id, userId int) (*Tag, error)
+	// InsertTag saves a new tag of the user, a name the user has already
+	// is a database.ErrConflict
+	InsertTag(ctx context.Context, userId int, name, color string) (int, error)
+	// UpdateTag renames and recolors a tag, names clash as in InsertTag
+	UpdateTag(ctx context.Context, id, userId int, name, color string) error
+	// DeleteTag deletes a tag and takes it off its todos
+	DeleteTag(ctx context.Context, id, userId int) error
+	// TagTodo puts a tag of the user on one of their live todos, or takes it
+	// off when !on, and returns the todo. The tags are not fields of the
+	// todo, so this changes neither its version nor its history.
+	TagTodo(ctx context.Context, todoId, tagId, userId int, on bool) (*Todo, error)
+}
+
+// GetStore returns the TodoStore registered on the request context
+func GetStore(c *gin.Context) TodoStore {
+	return c.MustGet("todo_store").(TodoStore)
+}
+
+// Storage is the sql implementation of TodoStore
 type Storage struct {
 	*database.Database
 }
 
-func NewStorage(c *gin.Context) *Storage {
-	db := c.MustGet("database").(*database.Database)
+func NewStorage(db *database.Database) *Storage {
 	return &Storage{Database: db}
 }
 
-func (s *Storage) InsertTodo(title, content string, userId int) error {
-	stmt, err := s.Database.Conn.Prepare("insert into todos(title, content, user_id) values (?, ?, ?)")
+var todoColumns = database.Columns(&Todo{}, "")
+
+// default orders of the todo list and of the trash
+var (
+	todosOrder = []SortKey{{Field: "position"}}
+	trashOrder = []SortKey{{Field: "deleted_at", Desc: true}, {Field: "id", Desc: true}}
+)
+
+func (t *Todo) Fields() database.Fields {
+	return database.Fields{
+		"id"           : &t.Id,
+		"title"        : &t.Title,
+		"content"      : &t.Content,
+		"done"         : &t.Done,
+		"user_id"      : &t.UserId,
+		"version"      : &t.Version,
+		"created_at"   : &t.CreatedAt,
+		"updated_at"   : &t.UpdatedAt,
+		"completed_at" : &t.CompletedAt,
+		"due_at"       : &t.DueAt,
+		"remind_at"    : &t.RemindAt,
+		"reminded_at"  : &t.RemindedAt,
+		"rrule"        : &t.RRule,
+		"series_id"    : &t.SeriesId,
+		"recurrence_at": &t.RecurrenceAt,
+		"priority"     : &t.Priority,
+		"position"     : &t.Position,
+		"deleted_at"   : &t.DeletedAt,
+	}
+}
+
+var seriesColumns = database.Columns(&Series{}, "")
+
+func (s *Series) Fields() database.Fields {
+	return database.Fields{
+		"id"           : &s.Id,
+		"user_id"      : &s.UserId,
+		"title"        : &s.Title,
+		"content"      : &s.Content,
+		"rrule"        : &s.RRule,
+		"priority"     : &s.Priority,
+		"start_at"     : &s.StartAt,
+		"remind_before": &s.RemindBefore,
+		"ended_at"     : &s.EndedAt,
+		"created_at"   : &s.CreatedAt,
+		"updated_at"   : &s.UpdatedAt,
+	}
+}
+
+var tagColumns = database.Columns(&Tag{}, "")
+
+// tagCounts is the todo_count column of a select of tags
+const tagCounts = "(select count(*) from todo_tags join todos on todos.id = todo_tags.todo_id where todo_tags.tag_id = tags.id and todos.deleted_at is null) as todo_count"
+
+// Fields leaves TodoCount out, it is counted by the selects that want it
+func (t *Tag) Fields() database.Fields {
+	return database.Fields{
+		"id"        : &t.Id,
+		"user_id"   : &t.UserId,
+		"name"      : &t.Name,
+		"color"     : &t.Color,
+		"created_at": &t.CreatedAt,
+		"updated_at": &t.UpdatedAt,
+	}
+}
+
+// countedTag is a Tag read with its tagCounts
+type countedTag struct {
+	Tag
+}
+
+func (t *countedTag) Fields() database.Fields {
+	fields := t.Tag.Fields()
+	fields["todo_count"] = &t.TodoCount
+	return fields
+}
+
+var revisionColumns = database.Columns(&Revision{}, "")
+
+func (r *Revision) Fields() database.Fields {
+	return database.Fields{
+		"id"        : &r.Id,
+		"todo_id"   : &r.TodoId,
+		"user_id"   : &r.UserId,
+		"action"    : &r.Action,
+		"title"     : &r.Title,
+		"content"   : &r.Content,
+		"done"      : &r.Done,
+		"changes"   : &r.Changes,
+		"created_at": &r.CreatedAt,
+	}
+}
+
+func (s *Storage) InsertTodo(ctx context.Context, draft Todo, userId int) (int, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	var todo *Todo
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) (err error) {
+		todo, err = s.insertTodo(ctx, tx, draft, userId)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.Database.MarkWrite(userId)
+	return todo.Id, nil
+}
+
+func (s *Storage) GetTodos(ctx context.Context, userId int, q ListQuery) (*[]Todo, error) {
+	return s.listTodos(ctx, userId, false, q, todosOrder)
+}
+
+func (s *Storage) GetTodoById(ctx context.Context, id, userId int) (*Todo, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	query := "select "+todoColumns+" from todos where id=? and deleted_at is null"
+	args  := []any{id}
+	if userId != 0 {
+		query += " and user_id=?"
+		args   = append(args, userId)
+	}
+
+	read := s.Database.Reader(userId)
+	stmt, err := read(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo Todo
+	err = database.ScanOne(rows, &todo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(ctx, read, []*Todo{&todo}); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func (s *Storage) GetTotalTodoCount(ctx context.Context, userId int, f ListFilter) (int, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	where, args := f.where()
+	stmt, err := s.Database.ReadStmt(ctx, userId, "select count(*) from todos where user_id=? and deleted_at is null"+where)
 	if err != nil {
+		return 0, err
+	}
+
+	todoCount := 0
+	if err := stmt.QueryRowContext(ctx, append([]any{userId}, args...)...).Scan(&todoCount); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+
+	return todoCount, nil
+}
+
+func (s *Storage) PatchTodo(ctx context.Context, userId int, todoId int, version int, scope string, patch func(todo *Todo) error) (*Todo, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	var todo *Todo
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) (err error) {
+		todo, err = s.patchTodo(ctx, tx, userId, todoId, version, scope, ActionUpdate, patch)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(title, content, userId)
+	s.Database.MarkWrite(userId)
+	return todo, nil
+}
+
+func (s *Storage) DeleteTodo(ctx context.Context, id, userId int, version int, scope string) error {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) error {
+		_, err := s.deleteTodo(ctx, tx, id, userId, version, scope)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
+	s.Database.MarkWrite(userId)
 	return nil
 }
 
-func (s *Storage) GetTodos(userId, limit, offset int) (*[]Todo, error) {
-	stmt, err := s.Database.Conn.Prepare("select * from todos where user_id=? limit ? offset ?")
+func (s *Storage) GetTrash(ctx context.Context, userId int, q ListQuery) (*[]Todo, error) {
+	return s.listTodos(ctx, userId, true, q, trashOrder)
+}
+
+// listTodos lists the trashed or the live todos of the user, def is the
+// order used when q has no Sort
+func (s *Storage) listTodos(ctx context.Context, userId int, trashed bool, q ListQuery, def []SortKey) (*[]Todo, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	query := "select "+todoColumns+" from todos where user_id=? and deleted_at is null"
+	if trashed {
+		query = "select "+todoColumns+" from todos where user_id=? and deleted_at is not null"
+	}
+	keys := sortKeys(q.Sort, def)
+	where, args := q.Filter.where()
+	args = append([]any{userId}, args...)
+	query += where
+
+	// a keyset page before the seek is read backwards and turned around below
+	back := q.Seek != nil && q.Seek.Back
+	if q.Seek != nil {
+		seek, seekArgs := seekWhere(keys, q.Seek)
+		query += seek + orderBy(keys, back) + " limit ?"
+		args = append(append(args, seekArgs...), q.Limit)
+	} else {
+		query += orderBy(keys, false) + " limit ? offset ?"
+		args = append(args, q.Limit, q.Offset)
+	}
+
+	read := s.Database.Reader(userId)
+	stmt, err := read(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query(userId, limit, offset) 
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +340,7 @@ func (s *Storage) GetTodos(userId, limit, offset int) (*[]Todo, error) {
 	todos := make([]Todo, 0)
 	for rows.Next() {
 		var todo Todo
-		if err := rows.Scan(&todo.Id, &todo.Title, &todo.Content, &todo.UserId, &todo.Done); err != nil {
+		if err := database.ScanRow(rows, &todo); err != nil {
 			return nil, err
 		}
 		todos = append(todos, todo)
@@ -57,82 +350,1144 @@ func (s *Storage) GetTodos(userId, limit, offset int) (*[]Todo, error) {
 		return nil, err
 	}
 
+	if err := s.loadTags(ctx, read, todoRefs(todos)); err != nil {
+		return nil, err
+	}
+
+	if back {
+		for i, j := 0, len(todos)-1; i < j; i, j = i+1, j-1 {
+			todos[i], todos[j] = todos[j], todos[i]
+		}
+	}
+
 	return &todos, nil
 }
 
-func (s *Storage) GetTodoById(id, userId int) (*Todo, error) {
-	var stmt *sql.Stmt
-	var err error
+func (s *Storage) RestoreTodo(ctx context.Context, id, userId int) error {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
 
-	if userId == 0 {
-		stmt, err = s.Database.Conn.Prepare("select * from todos where id=?")
-	} else {
-		stmt, err = s.Database.Conn.Prepare("select * from todos where id=? and user_id=?")
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) error {
+		_, err := s.trashTodo(ctx, tx, id, userId, false, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Database.MarkWrite(userId)
+	return nil
+}
+
+func (s *Storage) EmptyTrash(ctx context.Context, userId int) (int, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.Stmt(ctx, "delete from todos where user_id=? and deleted_at is not null")
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := stmt.ExecContext(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	s.Database.MarkWrite(userId)
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.Stmt(ctx, "delete from todos where deleted_at is not null and deleted_at < ?")
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := stmt.ExecContext(ctx, before.UTC())
+	if err != nil {
+		return 0, err
 	}
 
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *Storage) GetTodoHistory(ctx context.Context, id, userId int) (*[]Revision, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	read := s.Database.Reader(userId)
+	stmt, err := read(ctx, "select count(*) from todos where id=? and user_id=?")
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
-	var todo Todo
+	count := 0
+	if err := stmt.QueryRowContext(ctx, id, userId).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
 
-	if userId == 0 {
-		err = stmt.QueryRow(id).Scan(&todo.Id, &todo.Title, &todo.Content, &todo.UserId, &todo.Done)
-	} else {
-		err = stmt.QueryRow(id, userId).Scan(&todo.Id, &todo.Title, &todo.Content, &todo.UserId, &todo.Done)
+	stmt, err = read(ctx, "select "+revisionColumns+" from todo_revisions where todo_id=? order by id desc")
+	if err != nil {
+		return nil, err
 	}
 
+	rows, err := stmt.QueryContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &todo, nil
+	revisions := make([]Revision, 0)
+	for rows.Next() {
+		var revision Revision
+		if err := database.ScanRow(rows, &revision); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &revisions, nil
 }
 
-func (s *Storage) GetTotalTodoCount(userId int) (int, error) {
-	stmt, err := s.Database.Conn.Prepare("select count(*) from todos where user_id=?")
+func (s *Storage) RevertTodo(ctx context.Context, id, revisionId, userId int) error {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) error {
+		if _, err := s.lockTodo(ctx, tx, id, userId, false); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Stmt(ctx, "select "+revisionColumns+" from todo_revisions where id=? and todo_id=?")
+		if err != nil {
+			return err
+		}
+
+		rows, err := stmt.QueryContext(ctx, revisionId, id)
+		if err != nil {
+			return err
+		}
+
+		var revision Revision
+		err = database.ScanOne(rows, &revision)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("revision %d of todo %d: %w", revisionId, id, database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		// a revert is a change like any other, a done occurrence makes the next
+		_, err = s.patchTodo(ctx, tx, userId, id, 0, ScopeThis, ActionRevert, revision.revert)
+		return err
+	})
 	if err != nil {
-		return 0, err
+		return err
 	}
-	defer stmt.Close()
 
-	todoCount := 0
-	if err := stmt.QueryRow(userId).Scan(&todoCount); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return 0, err
+	s.Database.MarkWrite(userId)
+	return nil
+}
+
+func (s *Storage) SearchTodos(ctx context.Context, userId int, q string, limit, offset int) (*[]SearchHit, error) {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		hits := make([]SearchHit, 0)
+		return &hits, nil
+	}
+
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	var query string
+	var args  []any
+	switch s.Database.Dialect.Name() {
+	case database.DriverPostgres:
+		query = "select "+todoColumns+", ts_rank(search, tsq) as rank, " +
+			"ts_headline('english', case when to_tsvector('english', content) @@ tsq then content else title end, tsq, 'StartSel=" + markStart + ", StopSel=" + markEnd + ", MaxWords=16, MinWords=6') as snippet " +
+			"from todos, to_tsquery('english', ?) tsq where user_id=? and deleted_at is null and search @@ tsq order by rank desc, id limit ? offset ?"
+		args  = []any{postgresQuery(terms), userId, limit, offset}
+	case database.DriverSQLite:
+		return s.searchSQLite(ctx, userId, terms, limit, offset)
+	default:
+		query = "select "+todoColumns+", match(title, content) against (? in boolean mode) as rank, '' as snippet " +
+			"from todos where user_id=? and deleted_at is null and match(title, content) against (? in boolean mode) order by rank desc, id limit ? offset ?"
+		args  = []any{mysqlQuery(terms), userId, mysqlQuery(terms), limit, offset}
+	}
+
+	read := s.Database.Reader(userId)
+	stmt, err := read(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	for rows.Next() {
+		var hit SearchHit
+		if err := database.ScanRow(rows, &hit); err != nil {
+			return nil, err
 		}
+		// mysql has no highlighting of its own
+		if hit.Snippet == "" {
+			hit.Snippet = snippetOf(hit.Todo, terms)
+		}
+		hits = append(hits, hit)
 	}
 
-	return todoCount, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(ctx, read, hitRefs(hits)); err != nil {
+		return nil, err
+	}
+	return &hits, nil
 }
 
-func (s *Storage) UpdateTodo(userId int, todoId int, title string, content string, done bool) error {
-	stmt, err := s.Database.Conn.Prepare("update todos set title=?, content=?, done=? where user_id=? and id=?") 
+// searchSQLite is SearchTodos on the sqlite todos_fts table, fts_rank scores
+// the matchinfo of a row with the title weighing double
+func (s *Storage) searchSQLite(ctx context.Context, userId int, terms []string, limit, offset int) (*[]SearchHit, error) {
+	read := s.Database.Reader(userId)
+	stmt, err := read(ctx, "select "+database.Columns(&Todo{}, "todos")+", " +
+		"fts_rank(matchinfo(todos_fts, 'pcx'), 2.0, 1.0) as rank, snippet(todos_fts, '" + markStart + "', '" + markEnd + "', '...', -1, 16) as snippet " +
+		"from todos_fts join todos on todos.id = todos_fts.docid " +
+		"where todos_fts match ? and todos.user_id=? and todos.deleted_at is null order by rank desc, todos.id limit ? offset ?")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(title, content, done, userId, todoId)
+	rows, err := stmt.QueryContext(ctx, ftsQuery(terms), userId, limit, offset)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	hits := make([]SearchHit, 0)
+	for rows.Next() {
+		var hit SearchHit
+		if err := database.ScanRow(rows, &hit); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(ctx, read, hitRefs(hits)); err != nil {
+		return nil, err
+	}
+	return &hits, nil
 }
 
-func (s *Storage) DeleteTodo(id, userId int) error {
-	stmt, err := s.Database.Conn.Prepare("delete from todos where id=? and user_id=?") 
+func (s *Storage) BatchTodos(ctx context.Context, userId int, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	results := make([]BatchResult, len(ops))
+	failed  := -1
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) error {
+		for i, op := range ops {
+			if atomic {
+				todo, err := s.batchOp(ctx, tx, userId, op)
+				if err != nil {
+					failed = i
+					return err
+				}
+				results[i] = BatchResult{Todo: todo}
+				continue
+			}
+
+			// a failing op only rolls back its own savepoint
+			var todo *Todo
+			opErr, err := tx.Savepoint(ctx, "batch_op", func() (err error) {
+				todo, err = s.batchOp(ctx, tx, userId, op)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			results[i] = BatchResult{Todo: todo, Err: opErr}
+		}
+		return nil
+	})
+	if failed >= 0 {
+		return abortedResults(len(ops), failed, err), nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	s.Database.MarkWrite(userId)
+	return results, nil
+}
+
+func (s *Storage) PendingReminders(ctx context.Context, now time.Time, limit int) (*[]Todo, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.Stmt(ctx, "select "+todoColumns+" from todos where remind_at <= ? and reminded_at is null and done=? and deleted_at is null order by remind_at, id limit ?")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, now.UTC(), false, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := make([]Todo, 0)
+	for rows.Next() {
+		var todo Todo
+		if err := database.ScanRow(rows, &todo); err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(ctx, s.Database.Stmt, todoRefs(todos)); err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
+	return &todos, nil
+}
 
-	_, err = stmt.Exec(id, userId)
+func (s *Storage) MarkReminded(ctx context.Context, id int, remindAt time.Time, at time.Time) error {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	// not a change of the todo, so neither its version nor a revision. The
+	// times are stored to the microsecond, remind_at is matched within the
+	// microsecond of remindAt rather than compared for equality
+	stmt, err := s.Database.Stmt(ctx, "update todos set reminded_at=? where id=? and remind_at >= ? and remind_at < ?")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	from := *storedTime(&remindAt)
+	_, err = stmt.ExecContext(ctx, *storedTime(&at), id, from, from.Add(time.Microsecond))
+	return err
+}
+
+func (s *Storage) MoveTodo(ctx context.Context, userId int, todoId int, version int, targetId int, after bool) (*Todo, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	var todo *Todo
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) error {
+		before, err := s.lockTodo(ctx, tx, todoId, userId, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, version); err != nil {
+			return err
+		}
+		if err := checkTarget(todoId, targetId); err != nil {
+			return err
+		}
+		if err := s.lockList(ctx, tx, userId); err != nil {
+			return err
+		}
+
+		position, ok, err := s.positionBy(ctx, tx, userId, todoId, targetId, after)
+		if err == nil && !ok {
+			if err = s.renumber(ctx, tx, userId); err == nil {
+				position, _, err = s.positionBy(ctx, tx, userId, todoId, targetId, after)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		moved := *before
+		moved.Position = position
+		moved.Version++
+		stamp(before, &moved, database.Now())
+
+		if err := s.writeTodo(ctx, tx, &moved); err != nil {
+			return err
+		}
+		todo = &moved
+		return s.addRevision(ctx, tx, ActionMove, before, &moved, userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Database.MarkWrite(userId)
+	return todo, nil
+}
+
+// positionBy is the position right before the live todo targetId of the
+// user inside tx, or right after it, leaving todoId out of the list. ok is
+// false when there is no float left between the target and its neighbour.
+func (s *Storage) positionBy(ctx context.Context, tx *database.Tx, userId, todoId, targetId int, after bool) (float64, bool, error) {
+	stmt, err := tx.Stmt(ctx, "select position from todos where id=? and user_id=? and deleted_at is null")
+	if err != nil {
+		return 0, false, err
+	}
+
+	var target float64
+	err = stmt.QueryRowContext(ctx, targetId, userId).Scan(&target)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, targetMissing(targetId, after)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	query := "select position from todos where user_id=? and deleted_at is null and id<>? and (position < ? or (position=? and id < ?)) order by position desc, id desc limit 1"
+	if after {
+		query = "select position from todos where user_id=? and deleted_at is null and id<>? and (position > ? or (position=? and id > ?)) order by position, id limit 1"
+	}
+	stmt, err = tx.Stmt(ctx, query)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var next sql.NullFloat64
+	err = stmt.QueryRowContext(ctx, userId, todoId, target, target, targetId).Scan(&next)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	if after {
+		position, ok := between(&target, nullFloat(next))
+		return position, ok, nil
+	}
+	position, ok := between(nullFloat(next), &target)
+	return position, ok, nil
+}
+
+// renumber spreads the positions of the live todos of the user inside tx
+// positionGap apart, keeping their order. It is not a change of the todos,
+// so neither their versions nor revisions.
+func (s *Storage) renumber(ctx context.Context, tx *database.Tx, userId int) error {
+	stmt, err := tx.Stmt(ctx, "select id from todos where user_id=? and deleted_at is null order by position, id")
+	if err != nil {
+		return err
+	}
+
+	rows, err := stmt.QueryContext(ctx, userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	stmt, err = tx.Stmt(ctx, "update todos set position=? where id=?")
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if _, err := stmt.ExecContext(ctx, float64(i+1)*positionGap, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) GetTags(ctx context.Context, userId int) (*[]Tag, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.ReadStmt(ctx, userId, "select "+tagColumns+", "+tagCounts+" from tags where user_id=? order by name, id")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]Tag, 0)
+	for rows.Next() {
+		var tag countedTag
+		if err := database.ScanRow(rows, &tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag.Tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &tags, nil
+}
+
+func (s *Storage) GetTagById(ctx context.Context, id, userId int) (*Tag, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Database.ReadStmt(ctx, userId, "select "+tagColumns+", "+tagCounts+" from tags where id=? and user_id=?")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tag countedTag
+	err = database.ScanOne(rows, &tag)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("tag %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag.Tag, nil
+}
+
+func (s *Storage) InsertTag(ctx context.Context, userId int, name, color string) (int, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) (err error) {
+		if err := s.checkTagName(ctx, tx, userId, 0, name); err != nil {
+			return err
+		}
+
+		now := database.Now()
+		id, err = tx.Insert(ctx,
+			"insert into tags(user_id, name, color, created_at, updated_at) values (?, ?, ?, ?, ?)",
+			userId, name, color, now, now,
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.Database.MarkWrite(userId)
+	return id, nil
+}
+
+func (s *Storage) UpdateTag(ctx context.Context, id, userId int, name, color string) error {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) error {
+		if _, err := s.lockTag(ctx, tx, id, userId); err != nil {
+			return err
+		}
+		if err := s.checkTagName(ctx, tx, userId, id, name); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Stmt(ctx, "update tags set name=?, color=?, updated_at=? where id=?")
+		if err != nil {
+			return err
+		}
+
+		_, err = stmt.ExecContext(ctx, name, color, database.Now(), id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Database.MarkWrite(userId)
+	return nil
+}
+
+func (s *Storage) DeleteTag(ctx context.Context, id, userId int) error {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	// the todo_tags of the tag go with it
+	stmt, err := s.Database.Stmt(ctx, "delete from tags where id=? and user_id=?")
+	if err != nil {
+		return err
+	}
+
+	res, err := stmt.ExecContext(ctx, id, userId)
+	if err != nil {
+		return err
+	}
+	s.Database.MarkWrite(userId)
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("tag %d: %w", id, database.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) TagTodo(ctx context.Context, todoId, tagId, userId int, on bool) (*Todo, error) {
+	ctx, cancel := s.Database.WithTimeout(ctx)
+	defer cancel()
+
+	var todo *Todo
+	err := s.Database.WithTx(ctx, func(tx *database.Tx) (err error) {
+		if todo, err = s.lockTodo(ctx, tx, todoId, userId, false); err != nil {
+			return err
+		}
+		if _, err := s.lockTag(ctx, tx, tagId, userId); err != nil {
+			return err
+		}
+
+		// tagging twice is tagging once, a concurrent tagging included
+		query := s.Database.Dialect.InsertIgnore("insert into todo_tags(todo_id, tag_id) values (?, ?)")
+		if !on {
+			query = "delete from todo_tags where todo_id=? and tag_id=?"
+		}
+		stmt, err := tx.Stmt(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		res, err := stmt.ExecContext(ctx, todoId, tagId)
+		if err != nil {
+			return err
+		}
+		if !on {
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("tag %d of todo %d: %w", tagId, todoId, database.ErrNotFound)
+			}
+		}
+
+		return s.loadTags(ctx, tx.Stmt, []*Todo{todo})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Database.MarkWrite(userId)
+	return todo, nil
+}
+
+// batchOp runs an op of a batch inside tx
+func (s *Storage) batchOp(ctx context.Context, tx *database.Tx, userId int, op BatchOp) (*Todo, error) {
+	switch op.Action {
+	case ActionCreate:
+		return s.insertTodo(ctx, tx, op.Draft, userId)
+	case ActionUpdate:
+		return s.patchTodo(ctx, tx, userId, op.Id, op.Version, op.Scope, ActionUpdate, op.Patch)
+	case ActionDelete:
+		return s.deleteTodo(ctx, tx, op.Id, userId, op.Version, op.Scope)
+	}
+	return nil, fmt.Errorf("unknown batch action %q", op.Action)
+}
+
+// insertTodo is InsertTodo inside tx, a draft with an rrule and no series
+// starts one
+func (s *Storage) insertTodo(ctx context.Context, tx *database.Tx, draft Todo, userId int) (*Todo, error) {
+	now  := database.Now()
+	todo := newTodo(draft, userId, now)
+	if err := checkRecurrence(nil, &todo, ScopeThis); err != nil {
+		return nil, err
+	}
+	if todo.RRule != "" && todo.SeriesId == nil {
+		series := newSeries(&todo, now)
+		if err := s.saveSeries(ctx, tx, &series); err != nil {
+			return nil, err
+		}
+		todo.SeriesId, todo.RecurrenceAt = &series.Id, todo.DueAt
+	}
+
+	// new todos go to the end of the list
+	if err := s.lockList(ctx, tx, userId); err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Stmt(ctx, "select max(position) from todos where user_id=?")
+	if err != nil {
+		return nil, err
+	}
+	var last sql.NullFloat64
+	if err := stmt.QueryRowContext(ctx, userId).Scan(&last); err != nil {
+		return nil, err
+	}
+	todo.Position, _ = between(nullFloat(last), nil)
+
+	id, err := tx.Insert(ctx,
+		"insert into todos(title, content, user_id, created_at, updated_at, due_at, remind_at, rrule, series_id, recurrence_at, priority, position) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		todo.Title, todo.Content, todo.UserId, todo.CreatedAt, todo.UpdatedAt, todo.DueAt, todo.RemindAt, todo.RRule, todo.SeriesId, todo.RecurrenceAt, todo.Priority, todo.Position,
+	)
+	if err != nil {
+		return nil, err
+	}
+	todo.Id = id
+
+	if err := s.addRevision(ctx, tx, ActionCreate, nil, &todo, userId); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// patchTodo is PatchTodo inside tx, recorded as action
+func (s *Storage) patchTodo(ctx context.Context, tx *database.Tx, userId int, todoId int, version int, scope string, action string, patch func(todo *Todo) error) (*Todo, error) {
+	before, err := s.lockTodo(ctx, tx, todoId, userId, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(before, version); err != nil {
+		return nil, err
+	}
+
+	after, err := patched(before, patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRecurrence(before, &after, scope); err != nil {
+		return nil, err
+	}
+	now := database.Now()
+	stamp(before, &after, now)
+
+	// the series moves first, its rule may start over at after
+	var series *Series
+	var dropLater bool
+	switch {
+	case before.SeriesId == nil && after.RRule != "":
+		started := newSeries(&after, now)
+		if err := s.saveSeries(ctx, tx, &started); err != nil {
+			return nil, err
+		}
+		after.SeriesId, after.RecurrenceAt = &started.Id, after.DueAt
+	case before.SeriesId != nil && scope == ScopeFuture:
+		if series, err = s.lockSeries(ctx, tx, *before.SeriesId); err != nil {
+			return nil, err
+		}
+		dropLater = series.edit(before, &after, now)
+		if err := s.saveSeries(ctx, tx, series); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.writeTodo(ctx, tx, &after); err != nil {
+		return nil, err
+	}
+
+	if err := s.addRevision(ctx, tx, action, before, &after, userId); err != nil {
+		return nil, err
+	}
+
+	if series != nil {
+		if err := s.updateLater(ctx, tx, series, before, dropLater); err != nil {
+			return nil, err
+		}
+	}
+	if completes(before, &after) {
+		if err := s.advance(ctx, tx, &after); err != nil {
+			return nil, err
+		}
+	}
+	return &after, nil
+}
+
+// deleteTodo is DeleteTodo inside tx
+func (s *Storage) deleteTodo(ctx context.Context, tx *database.Tx, id, userId int, version int, scope string) (*Todo, error) {
+	todo, err := s.trashTodo(ctx, tx, id, userId, true, version)
+	if err != nil || todo.SeriesId == nil || todo.RecurrenceAt == nil {
+		return todo, err
+	}
+
+	if scope != ScopeFuture {
+		if todo.Done {
+			return todo, nil
+		}
+		return todo, s.advance(ctx, tx, todo)
+	}
+
+	series, err := s.lockSeries(ctx, tx, *todo.SeriesId)
+	if err != nil {
+		return nil, err
+	}
+	now := database.Now()
+	series.EndedAt, series.UpdatedAt = &now, now
+	if err := s.saveSeries(ctx, tx, series); err != nil {
+		return nil, err
+	}
+	return todo, s.updateLater(ctx, tx, series, todo, true)
+}
+
+// advance makes the occurrence of the series of todo after todo inside tx,
+// unless the series has ended or the occurrence was made already
+func (s *Storage) advance(ctx context.Context, tx *database.Tx, todo *Todo) error {
+	series, err := s.lockSeries(ctx, tx, *todo.SeriesId)
+	if err != nil {
+		return err
+	}
+	next, ok := series.next(*todo.RecurrenceAt)
+	if !ok {
+		return nil
+	}
+
+	stmt, err := tx.Stmt(ctx, "select count(*) from todos where series_id=? and recurrence_at=?")
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	if err := stmt.QueryRowContext(ctx, series.Id, next.RecurrenceAt.UTC()).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = s.insertTodo(ctx, tx, next, todo.UserId)
+	return err
+}
+
+// updateLater makes the live occurrences of series not done yet that come
+// after todo follow its template inside tx, or trashes them when drop
+func (s *Storage) updateLater(ctx context.Context, tx *database.Tx, series *Series, todo *Todo, drop bool) error {
+	stmt, err := tx.Stmt(ctx, "select id from todos where series_id=? and id<>? and recurrence_at > ? and done=? and deleted_at is null order by recurrence_at")
+	if err != nil {
+		return err
+	}
+
+	rows, err := stmt.QueryContext(ctx, series.Id, todo.Id, todo.RecurrenceAt.UTC(), false)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if drop {
+			_, err = s.trashTodo(ctx, tx, id, series.UserId, true, 0)
+		} else {
+			_, err = s.patchTodo(ctx, tx, series.UserId, id, 0, ScopeThis, ActionUpdate, series.follows)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockSeries reads a series inside tx and locks its row until the
+// transaction ends
+func (s *Storage) lockSeries(ctx context.Context, tx *database.Tx, id int) (*Series, error) {
+	stmt, err := tx.Stmt(ctx, "select "+seriesColumns+" from todo_series where id=?" + s.Database.Dialect.ForUpdate())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var series Series
+	err = database.ScanOne(rows, &series)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("series %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// saveSeries inserts series inside tx, or updates it when it has an id
+func (s *Storage) saveSeries(ctx context.Context, tx *database.Tx, series *Series) error {
+	if series.Id == 0 {
+		id, err := tx.Insert(ctx,
+			"insert into todo_series(user_id, title, content, rrule, priority, start_at, remind_before, ended_at, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			series.UserId, series.Title, series.Content, series.RRule, series.Priority, series.StartAt.UTC(), series.RemindBefore, series.EndedAt, series.CreatedAt, series.UpdatedAt,
+		)
+		series.Id = id
+		return err
+	}
+
+	stmt, err := tx.Stmt(ctx, "update todo_series set title=?, content=?, rrule=?, priority=?, start_at=?, remind_before=?, ended_at=?, updated_at=? where id=?")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.ExecContext(ctx, series.Title, series.Content, series.RRule, series.Priority, series.StartAt.UTC(), series.RemindBefore, series.EndedAt, series.UpdatedAt, series.Id)
+	return err
+}
+
+// trashTodo moves a todo to the trash or restores it from there inside tx
+func (s *Storage) trashTodo(ctx context.Context, tx *database.Tx, id, userId int, trash bool, version int) (*Todo, error) {
+	before, err := s.lockTodo(ctx, tx, id, userId, !trash)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(before, version); err != nil {
+		return nil, err
+	}
+
+	now    := database.Now()
+	after  := *before
+	action := ActionRestore
+	after.Version++
+	after.DeletedAt = nil
+	if trash {
+		after.DeletedAt = &now
+		action = ActionDelete
+	}
+	stamp(before, &after, now)
+
+	if err := s.writeTodo(ctx, tx, &after); err != nil {
+		return nil, err
+	}
+
+	if err := s.addRevision(ctx, tx, action, before, &after, userId); err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+// lockTodo reads a todo of the user inside tx and locks its row until the
+// transaction ends, trashed picks between the trashed and the live todos
+func (s *Storage) lockTodo(ctx context.Context, tx *database.Tx, id, userId int, trashed bool) (*Todo, error) {
+	query := "select "+todoColumns+" from todos where id=? and user_id=? and deleted_at is null"
+	if trashed {
+		query = "select "+todoColumns+" from todos where id=? and user_id=? and deleted_at is not null"
+	}
+
+	stmt, err := tx.Stmt(ctx, query + s.Database.Dialect.ForUpdate())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo Todo
+	err = database.ScanOne(rows, &todo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("todo %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(ctx, tx.Stmt, []*Todo{&todo}); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// writeTodo saves the new state of a todo locked by lockTodo
+func (s *Storage) writeTodo(ctx context.Context, tx *database.Tx, todo *Todo) error {
+	stmt, err := tx.Stmt(ctx, "update todos set title=?, content=?, done=?, version=?, updated_at=?, completed_at=?, due_at=?, remind_at=?, reminded_at=?, rrule=?, series_id=?, recurrence_at=?, priority=?, position=?, deleted_at=? where id=?")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.ExecContext(ctx,
+		todo.Title, todo.Content, todo.Done, todo.Version, todo.UpdatedAt, todo.CompletedAt,
+		todo.DueAt, todo.RemindAt, todo.RemindedAt, todo.RRule, todo.SeriesId, todo.RecurrenceAt, todo.Priority, todo.Position, todo.DeletedAt, todo.Id,
+	)
+	return err
+}
+
+// lockList locks the positions of the list of the user until tx ends, by
+// the row of the user, so concurrent creates and moves don't pick the same
+// position. postgres can't lock the rows of an aggregate like max(position).
+func (s *Storage) lockList(ctx context.Context, tx *database.Tx, userId int) error {
+	stmt, err := tx.Stmt(ctx, "select id from users where id=?" + s.Database.Dialect.ForUpdate())
+	if err != nil {
+		return err
+	}
+
+	var id int
+	err = stmt.QueryRowContext(ctx, userId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %d: %w", userId, database.ErrNotFound)
+	}
+	return err
+}
+
+// addRevision records the change from before to after made by userId inside tx
+func (s *Storage) addRevision(ctx context.Context, tx *database.Tx, action string, before, after *Todo, userId int) error {
+	r := newRevision(action, before, after, userId, database.Now())
+	_, err := tx.Insert(ctx,
+		"insert into todo_revisions(todo_id, user_id, action, title, content, done, changes, created_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		r.TodoId, r.UserId, r.Action, r.Title, r.Content, r.Done, r.Changes, r.CreatedAt,
+	)
+	return err
+}
+
+// lockTag reads a tag of the user inside tx and locks its row until the
+// transaction ends
+func (s *Storage) lockTag(ctx context.Context, tx *database.Tx, id, userId int) (*Tag, error) {
+	stmt, err := tx.Stmt(ctx, "select "+tagColumns+" from tags where id=? and user_id=?" + s.Database.Dialect.ForUpdate())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tag Tag
+	err = database.ScanOne(rows, &tag)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("tag %d: %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// checkTagName fails with database.ErrConflict when the user has another
+// tag than id named name, inside tx
+func (s *Storage) checkTagName(ctx context.Context, tx *database.Tx, userId, id int, name string) error {
+	stmt, err := tx.Stmt(ctx, "select count(*) from tags where user_id=? and name=? and id<>?")
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	if err := stmt.QueryRowContext(ctx, userId, name, id).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("tag %s: %w", name, database.ErrConflict)
+	}
+	return nil
+}
+
+// tagsChunk is how many todos loadTags reads the tags of at once, a short
+// chunk is padded so that every chunk is the same prepared statement
+const tagsChunk = 128
+
+// loadTags sets the tag names of todos, reading them with the statements
+// of prepare (the primary, a replica or a transaction)
+func (s *Storage) loadTags(ctx context.Context, prepare func(ctx context.Context, query string) (*sql.Stmt, error), todos []*Todo) error {
+	byId := make(map[int]*Todo, len(todos))
+	for _, todo := range todos {
+		todo.Tags = make([]string, 0)
+		byId[todo.Id] = todo
+	}
+	if len(todos) == 0 {
+		return nil
+	}
+
+	stmt, err := prepare(ctx, "select todo_tags.todo_id, tags.name from todo_tags join tags on tags.id = todo_tags.tag_id where todo_tags.todo_id in (" + placeholders(tagsChunk) + ")")
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(todos); start += tagsChunk {
+		// no todo has the id 0
+		ids := make([]any, tagsChunk)
+		for i := range ids {
+			ids[i] = 0
+			if start+i < len(todos) {
+				ids[i] = todos[start+i].Id
+			}
+		}
+		if err := scanTags(ctx, stmt, ids, byId); err != nil {
+			return err
+		}
+	}
+
+	for _, todo := range todos {
+		slices.Sort(todo.Tags)
+	}
+	return nil
+}
+
+// scanTags adds the tag names read by stmt for ids to the todos of byId
+func scanTags(ctx context.Context, stmt *sql.Stmt, ids []any, byId map[int]*Todo) error {
+	rows, err := stmt.QueryContext(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoId int
+		var name   string
+		if err := rows.Scan(&todoId, &name); err != nil {
+			return err
+		}
+		if todo, ok := byId[todoId]; ok {
+			todo.Tags = append(todo.Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// todoRefs points at the todos of todos, for loadTags
+func todoRefs(todos []Todo) []*Todo {
+	refs := make([]*Todo, len(todos))
+	for i := range todos {
+		refs[i] = &todos[i]
+	}
+	return refs
+}
+
+// hitRefs points at the todos of hits, for loadTags
+func hitRefs(hits []SearchHit) []*Todo {
+	refs := make([]*Todo, len(hits))
+	for i := range hits {
+		refs[i] = &hits[i].Todo
+	}
+	return refs
 }
@@ -0,0 +1,85 @@
+package todo
+
+import (
+	"io"
+	"log"
+	"time"
+	"context"
+	"testing"
+	"todogin/internal/config"
+	"todogin/internal/database"
+)
+
+// the users owning the todos of the tests
+const (
+	testUser  = 1
+	otherUser = 2
+)
+
+type testStore struct {
+	name  string
+	store TodoStore
+}
+
+// testStores returns a MemoryStorage and a Storage on a migrated sqlite
+// :memory: database, run every storage test against both
+func testStores(t *testing.T) []testStore {
+	t.Helper()
+
+	return []testStore{
+		{"memory", NewMemoryStorage()},
+		{"sqlite", NewStorage(testDatabase(t))},
+	}
+}
+
+func testDatabase(t *testing.T) *database.Database {
+	t.Helper()
+
+	conf := &config.Config{
+		DBDriver      : database.DriverSQLite,
+		DBPath        : ":memory:",
+		DBQueryTimeout: 5 * time.Second,
+	}
+
+	db, err := database.DatabaseInit(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// goose logs every migration
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+	if err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int{testUser, otherUser} {
+		_, err := db.Conn.Exec("insert into users(id, name, email, password) values (?, 'test', ?, 'x')", id, string(rune('a'+id))+"@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// insert saves draft for userId and returns its id
+func insert(t *testing.T, store TodoStore, userId int, draft Todo) int {
+	t.Helper()
+
+	id, err := store.InsertTodo(context.Background(), draft, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// ids lists the ids of todos
+func ids(todos []Todo) []int {
+	out := make([]int, len(todos))
+	for i, todo := range todos {
+		out[i] = todo.Id
+	}
+	return out
+}
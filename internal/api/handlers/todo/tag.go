@@ -0,0 +1,305 @@
+package todo
+
+import (
+	"fmt"
+	"path"
+	"time"
+	"strings"
+	"strconv"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"todogin/internal/api/handlers"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// maxTagFilter is the most tag names a list filter takes
+const maxTagFilter = 10
+
+// Tag is a label of the user, a todo carries the names of its tags
+type Tag struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	// Color is a "#rrggbb" hint for clients, empty for none
+	Color     string    `json:"color"`
+	// TodoCount is how many live todos have the tag
+	TodoCount int       `json:"todo_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		// names are listed comma separated in the filters
+		v.RegisterValidation("tagname", func(fl validator.FieldLevel) bool {
+			name := fl.Field().String()
+			return name != "" && name == strings.TrimSpace(name) && !strings.Contains(name, ",")
+		})
+	}
+}
+
+// tagNames reads a comma separated list of tag names, without blanks and
+// repeats
+func tagNames(s string) []string {
+	names := make([]string, 0)
+	seen  := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// hasTag reports whether todo has the tag name
+func hasTag(todo Todo, name string) bool {
+	for _, tag := range todo.Tags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TagReq creates a tag or replaces its name and color
+type TagReq struct {
+	Name  string `json:"name" binding:"required,max=50,tagname"`
+	Color string `json:"color" binding:"omitempty,hexcolor,len=7"`
+}
+
+// RegisterTagHandlers registers the routes of the tags of the user, the
+// routes tagging a todo are with the todo routes
+func RegisterTagHandlers(router *gin.RouterGroup) {
+	router.GET("", getTags)
+	router.POST("", postTag)
+	router.GET("/:id", getTag)
+	router.PUT("/:id", putTag)
+	router.DELETE("/:id", deleteTag)
+}
+
+// tagIdParam parses the tag id path parameter param, it writes the 400
+// response and returns false when it is not a valid id
+func tagIdParam(c *gin.Context, param string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil || id < 1 {
+		errs := make(handlers.ErrsMap, 0)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			fmt.Errorf("invalid tag id %q", c.Param(param)),
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return 0, false
+	}
+	return id, true
+}
+
+func getTags(c *gin.Context) {
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	tags, err := storage.GetTags(c.Request.Context(), userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTags", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"tags": *tags,
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func postTag(c *gin.Context) {
+	var req TagReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	id, err := storage.InsertTag(c.Request.Context(), userId, req.Name, req.Color)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.InsertTag", err)
+		return
+	}
+
+	tag, err := storage.GetTagById(c.Request.Context(), id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTagById", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "tag creation success",
+			"tag": *tag,
+		},
+		nil,
+		errs,
+	)
+	c.Header("Location", path.Join(c.FullPath(), strconv.Itoa(id)))
+	c.JSON(http.StatusCreated, resp)
+}
+
+func getTag(c *gin.Context) {
+	id, ok := tagIdParam(c, "id")
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	tag, err := storage.GetTagById(c.Request.Context(), id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTagById", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"tag": *tag,
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func putTag(c *gin.Context) {
+	id, ok := tagIdParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req TagReq
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errs, err := handlers.GetErrorMsgs(req, err)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	if err := storage.UpdateTag(c.Request.Context(), id, userId, req.Name, req.Color); err != nil {
+		handlers.AbortWithErr(c, "storage.UpdateTag", err)
+		return
+	}
+
+	tag, err := storage.GetTagById(c.Request.Context(), id, userId)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.GetTagById", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "tag is updated",
+			"tag": *tag,
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func deleteTag(c *gin.Context) {
+	id, ok := tagIdParam(c, "id")
+	if !ok {
+		return
+	}
+
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	if err := storage.DeleteTag(c.Request.Context(), id, userId); err != nil {
+		handlers.AbortWithErr(c, "storage.DeleteTag", err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg": "tag is deleted",
+		},
+		nil,
+		errs,
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+// tagTodo puts a tag on a todo, or takes it off with DELETE
+func tagTodo(c *gin.Context) {
+	id, ok := todoIdParam(c)
+	if !ok {
+		return
+	}
+	tagId, ok := tagIdParam(c, "tag_id")
+	if !ok {
+		return
+	}
+
+	on := c.Request.Method != http.MethodDelete
+	userId := c.MustGet("user_id").(int)
+	storage := GetStore(c)
+
+	todo, err := storage.TagTodo(c.Request.Context(), id, tagId, userId, on)
+	if err != nil {
+		handlers.AbortWithErr(c, "storage.TagTodo", err)
+		return
+	}
+
+	msg := "todo is tagged"
+	if !on {
+		msg = "todo is untagged"
+	}
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.OK,
+		map[string]any{
+			"msg" : msg,
+			"todo": *todo,
+		},
+		nil,
+		errs,
+	)
+	c.Header("ETag", etag(todo.Version))
+	c.JSON(http.StatusOK, resp)
+}
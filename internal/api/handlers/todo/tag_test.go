@@ -0,0 +1,202 @@
+package todo
+
+import (
+	"errors"
+	"slices"
+	"context"
+	"testing"
+	"todogin/internal/database"
+)
+
+func TestTagTodo(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		id := insert(t, ts.store, testUser, Todo{Title: "Walk the dog", Content: "some content"})
+		work, err := ts.store.InsertTag(ctx, testUser, "work", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		home, err := ts.store.InsertTag(ctx, testUser, "home", "#00ff00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.store.InsertTag(ctx, testUser, "work", ""); !errors.Is(err, database.ErrConflict) {
+			t.Errorf("%s: a second tag named work: %v", ts.name, err)
+		}
+
+		// tagging twice is tagging once
+		for _, tag := range []int{work, home, work} {
+			if _, err := ts.store.TagTodo(ctx, id, tag, testUser, true); err != nil {
+				t.Fatalf("%s: %v", ts.name, err)
+			}
+		}
+		todo, err := ts.store.GetTodoById(ctx, id, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(todo.Tags, []string{"home", "work"}) {
+			t.Errorf("%s: tags %v, want [home work]", ts.name, todo.Tags)
+		}
+
+		todo, err = ts.store.TagTodo(ctx, id, work, testUser, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(todo.Tags, []string{"home"}) {
+			t.Errorf("%s: untagged, tags %v, want [home]", ts.name, todo.Tags)
+		}
+		if _, err := ts.store.TagTodo(ctx, id, work, testUser, false); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: untagged twice: %v", ts.name, err)
+		}
+		if todo.Version != 1 {
+			t.Errorf("%s: tagging changed the version to %d", ts.name, todo.Version)
+		}
+
+		// the tags of another user are not theirs to use
+		other, err := ts.store.InsertTag(ctx, otherUser, "work", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.store.TagTodo(ctx, id, other, testUser, true); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: tagged with a tag of another user: %v", ts.name, err)
+		}
+	}
+}
+
+// tagged inserts a todo titled title with the tags named, the tags are
+// created on first use
+func tagged(t *testing.T, store TodoStore, tags map[string]int, title string, names ...string) int {
+	t.Helper()
+
+	ctx := context.Background()
+	id := insert(t, store, testUser, Todo{Title: title, Content: "some content"})
+	for _, name := range names {
+		if _, ok := tags[name]; !ok {
+			tag, err := store.InsertTag(ctx, testUser, name, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tags[name] = tag
+		}
+		if _, err := store.TagTodo(ctx, id, tags[name], testUser, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+// counts are the todo counts of the tags of testUser by name
+func counts(t *testing.T, store TodoStore) map[string]int {
+	t.Helper()
+
+	tags, err := store.GetTags(context.Background(), testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]int)
+	for _, tag := range *tags {
+		out[tag.Name] = tag.TodoCount
+	}
+	return out
+}
+
+func TestListByTags(t *testing.T) {
+	for _, ts := range testStores(t) {
+		tags := make(map[string]int)
+		a := tagged(t, ts.store, tags, "alpha", "work")
+		b := tagged(t, ts.store, tags, "bravo", "work", "home")
+		c := tagged(t, ts.store, tags, "charlie", "home")
+		tagged(t, ts.store, tags, "delta")
+
+		tests := []struct {
+			name   string
+			filter ListFilter
+			want   []int
+		}{
+			{"any of one", ListFilter{TagsAny: []string{"work"}}, []int{a, b}},
+			{"any of two", ListFilter{TagsAny: []string{"work", "home"}}, []int{a, b, c}},
+			{"all of two", ListFilter{TagsAll: []string{"work", "home"}}, []int{b}},
+			{"any and all", ListFilter{TagsAny: []string{"work"}, TagsAll: []string{"home"}}, []int{b}},
+			{"all with a missing tag", ListFilter{TagsAll: []string{"work", "garden"}}, []int{}},
+			{"any of a missing tag", ListFilter{TagsAny: []string{"garden"}}, []int{}},
+		}
+
+		for _, tt := range tests {
+			todos, err := ts.store.GetTodos(context.Background(), testUser, ListQuery{Limit: 100, Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("%s %s: %v", ts.name, tt.name, err)
+			}
+			if got := ids(*todos); !slices.Equal(got, tt.want) {
+				t.Errorf("%s %s: %v, want %v", ts.name, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRenameDeleteTag(t *testing.T) {
+	for _, ts := range testStores(t) {
+		ctx := context.Background()
+
+		tags := make(map[string]int)
+		a := tagged(t, ts.store, tags, "alpha", "work")
+		b := tagged(t, ts.store, tags, "bravo", "work", "home")
+		if _, err := ts.store.InsertTag(ctx, otherUser, "garden", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// the tags of others are not listed, the trashed todos not counted
+		if got := counts(t, ts.store); got["work"] != 2 || got["home"] != 1 || len(got) != 2 {
+			t.Errorf("%s: counts %v", ts.name, got)
+		}
+		if err := ts.store.DeleteTodo(ctx, b, testUser, 0, ScopeThis); err != nil {
+			t.Fatal(err)
+		}
+		if got := counts(t, ts.store); got["work"] != 1 || got["home"] != 0 {
+			t.Errorf("%s: counts %v after a delete", ts.name, got)
+		}
+
+		// a rename follows the todos, onto a name in use it conflicts
+		if err := ts.store.UpdateTag(ctx, tags["work"], testUser, "office", "#0000ff"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.store.UpdateTag(ctx, tags["home"], testUser, "office", ""); !errors.Is(err, database.ErrConflict) {
+			t.Errorf("%s: renamed onto office: %v", ts.name, err)
+		}
+		if err := ts.store.UpdateTag(ctx, tags["home"], testUser, "home", "#00ff00"); err != nil {
+			t.Errorf("%s: recolored: %v", ts.name, err)
+		}
+		todo, err := ts.store.GetTodoById(ctx, a, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(todo.Tags, []string{"office"}) {
+			t.Errorf("%s: renamed, tags %v, want [office]", ts.name, todo.Tags)
+		}
+		todos, err := ts.store.GetTodos(ctx, testUser, ListQuery{Limit: 100, Filter: ListFilter{TagsAny: []string{"office"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(*todos); !slices.Equal(got, []int{a}) {
+			t.Errorf("%s: tagged office %v, want %v", ts.name, got, []int{a})
+		}
+
+		// a deleted tag leaves its todos
+		if err := ts.store.DeleteTag(ctx, tags["work"], testUser); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.store.DeleteTag(ctx, tags["work"], testUser); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s: deleted twice: %v", ts.name, err)
+		}
+		todo, err = ts.store.GetTodoById(ctx, a, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(todo.Tags) != 0 {
+			t.Errorf("%s: tags %v after the delete", ts.name, todo.Tags)
+		}
+		if got := counts(t, ts.store); len(got) != 1 || got["home"] != 0 {
+			t.Errorf("%s: counts %v after the delete", ts.name, got)
+		}
+	}
+}
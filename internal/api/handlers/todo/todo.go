@@ -1,21 +1,208 @@
 package todo
 
+import (
+	"time"
+)
+
 type Todo struct {
-	Id      int    `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Done    bool   `json:"done"`
-	UserId  int    `json:"user_id"`
+	Id           int        `json:"id"`
+	Title        string     `json:"title"`
+	Content      string     `json:"content"`
+	Done         bool       `json:"done"`
+	UserId       int        `json:"user_id"`
+	Version      int        `json:"version"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	// CompletedAt is when done last became true, nil while not done
+	CompletedAt  *time.Time `json:"completed_at"`
+	DueAt        *time.Time `json:"due_at"`
+	RemindAt     *time.Time `json:"remind_at"`
+	// RemindedAt is when the reminder set for RemindAt was delivered, nil
+	// until then
+	RemindedAt   *time.Time `json:"reminded_at"`
+	// RRule makes the todo recurring (e.g. "FREQ=WEEKLY;BYDAY=MO"), it is
+	// an occurrence of the series SeriesId due at RecurrenceAt by the rule,
+	// whatever its own due time became. The rule is expanded in UTC.
+	RRule        string     `json:"rrule,omitempty"`
+	SeriesId     *int       `json:"series_id,omitempty"`
+	RecurrenceAt *time.Time `json:"recurrence_at,omitempty"`
+	Priority     int        `json:"priority"`
+	// Position orders the list of the user, it only changes by a move
+	Position     float64    `json:"position"`
+	// Tags are the names of the tags of the todo, sorted
+	Tags         []string   `json:"tags"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+// priority levels of a todo
+const (
+	PriorityNone   = 0
+	PriorityLow    = 1
+	PriorityMedium = 2
+	PriorityHigh   = 3
+)
+
+// stamp sets the timestamps of after, the new state of before, for a change made at now
+func stamp(before, after *Todo, now time.Time) {
+	after.UpdatedAt = now
+	switch {
+	case !after.Done:
+		after.CompletedAt = nil
+	case !before.Done:
+		after.CompletedAt = &now
+	}
+	// a new reminder time is a new reminder to deliver
+	if !sameTime(before.RemindAt, after.RemindAt) {
+		after.RemindedAt = nil
+	}
+}
+
+// newTodo is the todo InsertTodo makes of draft at now, the series fields
+// are set by the stores only
+func newTodo(draft Todo, userId int, now time.Time) Todo {
+	return Todo{
+		Title       : draft.Title,
+		Content     : draft.Content,
+		UserId      : userId,
+		Version     : 1,
+		CreatedAt   : now,
+		UpdatedAt   : now,
+		DueAt       : storedTime(draft.DueAt),
+		RemindAt    : storedTime(draft.RemindAt),
+		RRule       : canonicalRule(draft.RRule),
+		SeriesId    : draft.SeriesId,
+		RecurrenceAt: storedTime(draft.RecurrenceAt),
+		Priority    : draft.Priority,
+		Tags        : make([]string, 0),
+	}
+}
+
+// sameTime reports whether a and b are the same time or both missing
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// storedTime is t as the databases keep it, in UTC to the microsecond
+func storedTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	stored := t.UTC().Truncate(time.Microsecond)
+	return &stored
 }
 
 type TodoCreateReq struct {
-	Title   string `json:"title" binding:"required,min=5,max=100"`
-	Content string `json:"content" binding:"required,min=5,max=255"`
+	Title    string     `json:"title" binding:"required,min=5,max=100"`
+	Content  string     `json:"content" binding:"required,min=5,max=255"`
+	// a recurring todo starts its rule at its due time
+	DueAt    *time.Time `json:"due_at" binding:"required_with=RRule"`
+	RemindAt *time.Time `json:"remind_at"`
+	RRule    string     `json:"rrule" binding:"omitempty,max=255,rrule"`
+	Priority int        `json:"priority" binding:"gte=0,lte=3"`
+}
+
+// draft is the todo req creates
+func (req TodoCreateReq) draft() Todo {
+	return Todo{Title: req.Title, Content: req.Content, DueAt: req.DueAt, RemindAt: req.RemindAt, RRule: req.RRule, Priority: req.Priority}
+}
+
+// patched returns the next version of before with the title, content,
+// done, due and reminder times, rrule and priority set by patch, the other
+// fields are not patch's to change
+func patched(before *Todo, patch func(todo *Todo) error) (Todo, error) {
+	draft := *before
+	if err := patch(&draft); err != nil {
+		return Todo{}, err
+	}
+
+	after := *before
+	after.Title, after.Content, after.Done = draft.Title, draft.Content, draft.Done
+	after.DueAt, after.RemindAt = storedTime(draft.DueAt), storedTime(draft.RemindAt)
+	after.RRule, after.Priority = canonicalRule(draft.RRule), draft.Priority
+	after.Version++
+	return after, nil
 }
 
+// TodoGetReq is read from the query string, or from a json body for the
+// clients written before lists took query parameters
 type TodoGetReq struct {
-	Offset int `json:"offset" binding:"gte=0"`
-	Limit  int `json:"limit" binding:"required,gte=1,lte=100"`
+	Offset          int        `json:"offset" form:"offset" binding:"gte=0"`
+	Limit           int        `json:"limit" form:"limit" binding:"required,gte=1,lte=100"`
+	// Cursor is a next_cursor or prev_cursor of an earlier page, it brings
+	// its sort and filters along and cannot be mixed with offset
+	Cursor          string     `json:"cursor" form:"cursor"`
+	// Sort is a ParseSort list, e.g. "created_at,-title"
+	Sort            string     `json:"sort" form:"sort"`
+	Done            *bool      `json:"done" form:"done"`
+	// Q keeps the todos whose title or content contains it, ignoring case
+	Q               string     `json:"q" form:"q" binding:"max=100"`
+	CreatedAfter    *time.Time `json:"created_after" form:"created_after"`
+	CreatedBefore   *time.Time `json:"created_before" form:"created_before"`
+	UpdatedAfter    *time.Time `json:"updated_after" form:"updated_after"`
+	UpdatedBefore   *time.Time `json:"updated_before" form:"updated_before"`
+	CompletedAfter  *time.Time `json:"completed_after" form:"completed_after"`
+	CompletedBefore *time.Time `json:"completed_before" form:"completed_before"`
+	DueAfter        *time.Time `json:"due_after" form:"due_after"`
+	DueBefore       *time.Time `json:"due_before" form:"due_before"`
+	// Overdue keeps the todos not done and past their due time, or the others
+	Overdue         *bool      `json:"overdue" form:"overdue"`
+	// DueToday keeps the todos due today in TZ, an IANA time zone (UTC by default)
+	DueToday        bool       `json:"due_today" form:"due_today"`
+	TZ              string     `json:"tz" form:"tz" binding:"omitempty,timezone"`
+	// SeriesId keeps the occurrences of a recurring todo
+	SeriesId        *int       `json:"series_id" form:"series_id" binding:"omitempty,gte=1"`
+	Priority        *int       `json:"priority" form:"priority" binding:"omitempty,gte=0,lte=3"`
+	// TagsAny keeps the todos with any of these comma separated tag names,
+	// TagsAll the todos with all of them
+	TagsAny         string     `json:"tags_any" form:"tags_any"`
+	TagsAll         string     `json:"tags_all" form:"tags_all"`
+}
+
+// Filter returns the ListFilter of req, the relative filters (overdue and
+// due today) are resolved against now
+func (req TodoGetReq) Filter(now time.Time) ListFilter {
+	f := ListFilter{
+		Done           : req.Done,
+		Q              : req.Q,
+		CreatedAfter   : req.CreatedAfter,
+		CreatedBefore  : req.CreatedBefore,
+		UpdatedAfter   : req.UpdatedAfter,
+		UpdatedBefore  : req.UpdatedBefore,
+		CompletedAfter : req.CompletedAfter,
+		CompletedBefore: req.CompletedBefore,
+		DueAfter       : req.DueAfter,
+		DueBefore      : req.DueBefore,
+		SeriesId       : req.SeriesId,
+		Priority       : req.Priority,
+		TagsAny        : tagNames(req.TagsAny),
+		TagsAll        : tagNames(req.TagsAll),
+	}
+
+	if req.Overdue != nil {
+		f.Overdue, f.OverdueAt = req.Overdue, &now
+	}
+
+	if req.DueToday {
+		// the binding checked the zone already
+		loc, err := time.LoadLocation(req.TZ)
+		if err != nil {
+			loc = time.UTC
+		}
+		y, m, d := now.In(loc).Date()
+		start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		end   := start.AddDate(0, 0, 1)
+		if f.DueAfter == nil || f.DueAfter.Before(start) {
+			f.DueAfter = &start
+		}
+		if f.DueBefore == nil || f.DueBefore.After(end) {
+			f.DueBefore = &end
+		}
+	}
+
+	return f
 }
 
 type TodoUpdateReq struct {
@@ -23,8 +210,130 @@ type TodoUpdateReq struct {
 	Title   string `json:"title" binding:"required,min=5,max=100"`
 	Content string `json:"content" binding:"required,min=5,max=255"`
 	Done    bool   `json:"done" binding:"boolean"`
+	// Version, like the If-Match header, makes the update fail unless the todo
+	// still has this version, 0 updates whatever the version is
+	Version  int        `json:"version" binding:"gte=0"`
+	// the clients written before todos had times leave them out, so the
+	// times left out are kept
+	DueAt    *time.Time `json:"due_at"`
+	RemindAt *time.Time `json:"remind_at"`
+	RRule    *string    `json:"rrule" binding:"omitempty,max=255,rrule"`
+	Priority *int       `json:"priority" binding:"omitempty,gte=0,lte=3"`
+	// Scope of an update of a recurring todo, "this" occurrence (the
+	// default) or the "future" ones too
+	Scope    string     `json:"scope" binding:"omitempty,oneof=this future"`
+}
+
+// patch applies req to todo
+func (req TodoUpdateReq) patch(todo *Todo) error {
+	todo.Title, todo.Content, todo.Done = req.Title, req.Content, req.Done
+	if req.DueAt != nil {
+		todo.DueAt = req.DueAt
+	}
+	if req.RemindAt != nil {
+		todo.RemindAt = req.RemindAt
+	}
+	if req.RRule != nil {
+		todo.RRule = *req.RRule
+	}
+	if req.Priority != nil {
+		todo.Priority = *req.Priority
+	}
+	return nil
+}
+
+// TodoPutReq replaces a todo, its id comes from the path
+type TodoPutReq struct {
+	Title    string     `json:"title" binding:"required,min=5,max=100"`
+	Content  string     `json:"content" binding:"required,min=5,max=255"`
+	Done     bool       `json:"done" binding:"boolean"`
+	Version  int        `json:"version" binding:"gte=0"`
+	DueAt    *time.Time `json:"due_at" binding:"required_with=RRule"`
+	RemindAt *time.Time `json:"remind_at"`
+	RRule    string     `json:"rrule" binding:"omitempty,max=255,rrule"`
+	Priority int        `json:"priority" binding:"gte=0,lte=3"`
+}
+
+// patch replaces the fields of todo with req, the times, the rrule and the
+// priority left out are cleared
+func (req TodoPutReq) patch(todo *Todo) error {
+	todo.Title, todo.Content, todo.Done = req.Title, req.Content, req.Done
+	todo.DueAt, todo.RemindAt, todo.RRule = req.DueAt, req.RemindAt, req.RRule
+	todo.Priority = req.Priority
+	return nil
+}
+
+// TodoPatchReq changes the fields it sets and keeps the others, a merge
+// patch is the way to clear a time
+type TodoPatchReq struct {
+	Title    *string    `json:"title" binding:"omitempty,min=5,max=100"`
+	Content  *string    `json:"content" binding:"omitempty,min=5,max=255"`
+	Done     *bool      `json:"done"`
+	Version  int        `json:"version" binding:"gte=0"`
+	DueAt    *time.Time `json:"due_at"`
+	RemindAt *time.Time `json:"remind_at"`
+	RRule    *string    `json:"rrule" binding:"omitempty,max=255,rrule"`
+	Priority *int       `json:"priority" binding:"omitempty,gte=0,lte=3"`
+}
+
+// mergePatch is the json merge patch of the fields req sets
+func (req TodoPatchReq) mergePatch() docPatch {
+	patch := make(map[string]any)
+	if req.Title != nil {
+		patch["title"] = *req.Title
+	}
+	if req.Content != nil {
+		patch["content"] = *req.Content
+	}
+	if req.Done != nil {
+		patch["done"] = *req.Done
+	}
+	if req.DueAt != nil {
+		patch["due_at"] = *req.DueAt
+	}
+	if req.RemindAt != nil {
+		patch["remind_at"] = *req.RemindAt
+	}
+	if req.RRule != nil {
+		patch["rrule"] = *req.RRule
+	}
+	if req.Priority != nil {
+		patch["priority"] = *req.Priority
+	}
+
+	return func(doc any) (any, error) {
+		return mergePatch(doc, patch), nil
+	}
+}
+
+// TodoScopeQuery is the scope of a change to a recurring todo, "this"
+// occurrence (the default) or the "future" ones too
+type TodoScopeQuery struct {
+	Scope string `form:"scope" binding:"omitempty,oneof=this future"`
+}
+
+// TodoVersionQuery is the version of the requests without a body
+type TodoVersionQuery struct {
+	Version int `form:"version" binding:"gte=0"`
+	TodoScopeQuery
 }
 
 type TodoDeleteReq struct {
+	Id      int    `json:"id" binding:"required,gte=1"`
+	Version int    `json:"version" binding:"gte=0"`
+	// Scope "future" ends the series of a recurring todo, "this" (the
+	// default) skips to its next occurrence
+	Scope   string `json:"scope" binding:"omitempty,oneof=this future"`
+}
+
+// TodoMoveReq places a todo right before or right after another todo of
+// the list, exactly one of them is set
+type TodoMoveReq struct {
+	Before  *int `json:"before" binding:"required_without=After,excluded_with=After,omitempty,gte=1"`
+	After   *int `json:"after" binding:"omitempty,gte=1"`
+	Version int  `json:"version" binding:"gte=0"`
+}
+
+type TodoRestoreReq struct {
 	Id int `json:"id" binding:"required,gte=1"`
 }
@@ -0,0 +1,122 @@
+package todo
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"strconv"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"todogin/internal/database"
+	"todogin/internal/api/handlers"
+)
+
+// StaleError is returned by writes that name a version the todo no longer
+// has, Current is the todo as it is now
+type StaleError struct {
+	Current Todo
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("todo %d: %v (current version %d)", e.Current.Id, database.ErrVersionMismatch, e.Current.Version)
+}
+
+func (e *StaleError) Unwrap() error {
+	return database.ErrVersionMismatch
+}
+
+// checkVersion fails with a *StaleError unless version is 0 or the version of todo
+func checkVersion(todo *Todo, version int) error {
+	if version != 0 && version != todo.Version {
+		return &StaleError{Current: *todo}
+	}
+	return nil
+}
+
+// etag is the ETag header value of a todo version
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseIfMatch returns the version named by an If-Match header, 0 for an
+// empty header or "*"
+func parseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if unquoted, err := strconv.Unquote(tag); err == nil {
+		tag = unquoted
+	}
+
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match header %q", header)
+	}
+	return version, nil
+}
+
+// requestVersion merges the If-Match header with the version field of the
+// body, it writes the 400 response and returns false when they disagree
+func requestVersion(c *gin.Context, bodyVersion int) (int, bool) {
+	version, err := parseIfMatch(c.GetHeader("If-Match"))
+	if err == nil && version != 0 && bodyVersion != 0 && version != bodyVersion {
+		err = fmt.Errorf("If-Match version %d and body version %d differ", version, bodyVersion)
+	}
+	if err != nil {
+		errs := make(handlers.ErrsMap, 0)
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			err,
+			errs,
+		)
+		c.JSON(http.StatusBadRequest, resp)
+		return 0, false
+	}
+
+	if version == 0 {
+		version = bodyVersion
+	}
+	return version, true
+}
+
+// abortWithErr is handlers.AbortWithErr that answers a *StaleError with
+// 412 and the current state of the todo, and a *PatchError with its status
+func abortWithErr(c *gin.Context, op string, err error) {
+	var patchErr *PatchError
+	if errors.As(err, &patchErr) {
+		errs := patchErr.Errs
+		if errs == nil {
+			errs = make(handlers.ErrsMap, 0)
+		}
+		resp := handlers.NewResp(
+			handlers.FAIL,
+			map[string]any{},
+			patchErr,
+			errs,
+		)
+		c.AbortWithStatusJSON(patchErr.Status, resp)
+		return
+	}
+
+	var stale *StaleError
+	if !errors.As(err, &stale) {
+		handlers.AbortWithErr(c, op, err)
+		return
+	}
+
+	errs := make(handlers.ErrsMap, 0)
+	resp := handlers.NewResp(
+		handlers.FAIL,
+		map[string]any{
+			"todo": stale.Current,
+		},
+		err,
+		errs,
+	)
+	c.Header("ETag", etag(stale.Current.Version))
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, resp)
+}
@@ -2,15 +2,43 @@ package config
 
 import (
 	"fmt"
+	"time"
+	"strconv"
+	"strings"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	ServerAddr       string
+	DBDriver         string
+	DBPath           string
 	DBAddr           string
 	DBUser           string
 	DBPasswd         string 
 	DBName           string
+	DBSSLMode        string
+	DBMigrateOnStart bool
+	DBQueryTimeout   time.Duration
+	// connection pool
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	// prepared statements kept per pool, 0 prepares every query per call
+	DBStmtCacheSize   int
+	// initial ping retries, the backoff doubles after every failed attempt
+	DBConnectRetries int
+	DBConnectBackoff time.Duration
+	// read replicas, they share the user, password and name of the primary
+	DBReplicaAddrs         []string
+	DBReadYourWritesWindow time.Duration
+	// trashed todos are permanently deleted after TrashRetention (0 keeps them)
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// reminders are checked every ReminderInterval (0 disables them), they are
+	// posted to ReminderWebhookURL or logged when it is empty
+	ReminderInterval   time.Duration
+	ReminderWebhookURL string
 	JwtTokenLifetime string
 	JwtSecretKey     string
 }
@@ -30,26 +58,90 @@ func ConfigInit() (*Config, error) {
 	}
 	c.ServerAddr = val
 
-	if val, err = getVal(&vals, "DBAddr"); err != nil {
+	c.DBDriver = getValOr(&vals, "DBDriver", "mysql")
+	c.DBPath   = getValOr(&vals, "DBPath", "todogin.db")
+
+	// only the drivers talking to a server need its address and credentials
+	network := c.DBDriver == "mysql" || c.DBDriver == "postgres"
+
+	if val, err = getValIf(&vals, "DBAddr", network); err != nil {
 		return nil, err
 	}
 	c.DBAddr = val
 
-	if val, err = getVal(&vals, "DBUser"); err != nil {
+	if val, err = getValIf(&vals, "DBUser", network); err != nil {
 		return nil, err
 	}
 	c.DBUser = val
 
-	if val, err = getVal(&vals, "DBPasswd"); err != nil {
+	if val, err = getValIf(&vals, "DBPasswd", network); err != nil {
 		return nil, err
 	}
 	c.DBPasswd = val
 
-	if val, err = getVal(&vals, "DBName"); err != nil {
+	if val, err = getValIf(&vals, "DBName", network); err != nil {
 		return nil, err
 	}
 	c.DBName = val
 
+	c.DBSSLMode = getValOr(&vals, "DBSSLMode", "disable")
+
+	if c.DBMigrateOnStart, err = getBoolOr(&vals, "DBMigrateOnStart", false); err != nil {
+		return nil, err
+	}
+
+	if c.DBQueryTimeout, err = getDurationOr(&vals, "DBQueryTimeout", 5 * time.Second); err != nil {
+		return nil, err
+	}
+
+	if c.DBMaxOpenConns, err = getIntOr(&vals, "DBMaxOpenConns", 25); err != nil {
+		return nil, err
+	}
+
+	if c.DBMaxIdleConns, err = getIntOr(&vals, "DBMaxIdleConns", 25); err != nil {
+		return nil, err
+	}
+
+	if c.DBConnMaxLifetime, err = getDurationOr(&vals, "DBConnMaxLifetime", 5 * time.Minute); err != nil {
+		return nil, err
+	}
+
+	if c.DBConnMaxIdleTime, err = getDurationOr(&vals, "DBConnMaxIdleTime", time.Minute); err != nil {
+		return nil, err
+	}
+
+	if c.DBStmtCacheSize, err = getIntOr(&vals, "DBStmtCacheSize", 256); err != nil {
+		return nil, err
+	}
+
+	if c.DBConnectRetries, err = getIntOr(&vals, "DBConnectRetries", 5); err != nil {
+		return nil, err
+	}
+
+	if c.DBConnectBackoff, err = getDurationOr(&vals, "DBConnectBackoff", 500 * time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	c.DBReplicaAddrs = getList(&vals, "DBReplicaAddrs")
+
+	if c.DBReadYourWritesWindow, err = getDurationOr(&vals, "DBReadYourWritesWindow", 5 * time.Second); err != nil {
+		return nil, err
+	}
+
+	if c.TrashRetention, err = getDurationOr(&vals, "TrashRetention", 30 * 24 * time.Hour); err != nil {
+		return nil, err
+	}
+
+	if c.TrashPurgeInterval, err = getDurationOr(&vals, "TrashPurgeInterval", time.Hour); err != nil {
+		return nil, err
+	}
+
+	if c.ReminderInterval, err = getDurationOr(&vals, "ReminderInterval", time.Minute); err != nil {
+		return nil, err
+	}
+
+	c.ReminderWebhookURL = getValOr(&vals, "ReminderWebhookURL", "")
+
 	if val, err = getVal(&vals, "JwtTokenLifetime"); err != nil {
 		return nil, err
 	}
@@ -69,3 +161,53 @@ func getVal(vals *map[string]string, key string) (string, error) {
 	}
 	return "", &ConfError{fmt.Sprintf("%q key is not found", key), nil}
 }
+
+// getValIf is getVal when required, the key may be missing otherwise
+func getValIf(vals *map[string]string, key string, required bool) (string, error) {
+	if required {
+		return getVal(vals, key)
+	}
+	return getValOr(vals, key, ""), nil
+}
+
+func getValOr(vals *map[string]string, key string, def string) string {
+	if val, ok := (*vals)[key]; ok && val != "" {
+		return val
+	}
+	return def
+}
+
+func getIntOr(vals *map[string]string, key string, def int) (int, error) {
+	val, err := strconv.Atoi(getValOr(vals, key, strconv.Itoa(def)))
+	if err != nil {
+		return 0, &ConfError{fmt.Sprintf("%q should be an integer", key), err}
+	}
+	return val, nil
+}
+
+func getBoolOr(vals *map[string]string, key string, def bool) (bool, error) {
+	val, err := strconv.ParseBool(getValOr(vals, key, strconv.FormatBool(def)))
+	if err != nil {
+		return false, &ConfError{fmt.Sprintf("%q should be a boolean", key), err}
+	}
+	return val, nil
+}
+
+func getDurationOr(vals *map[string]string, key string, def time.Duration) (time.Duration, error) {
+	val, err := time.ParseDuration(getValOr(vals, key, def.String()))
+	if err != nil {
+		return 0, &ConfError{fmt.Sprintf("%q should be a duration (e.g. 5s)", key), err}
+	}
+	return val, nil
+}
+
+// getList splits a comma separated value, empty items are dropped
+func getList(vals *map[string]string, key string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(getValOr(vals, key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -10,5 +10,5 @@ type ConfError struct {
 }
 
 func (e *ConfError) Error() string {
-	return fmt.Sprintf("Config Err: %s: %w", e.msg, e.Err)
+	return fmt.Sprintf("Config Err: %s: %v", e.msg, e.Err)
 }
@@ -1,34 +1,249 @@
 package database
 
 import (
+	"fmt"
+	"log"
+	"time"
+	"context"
+	"net/url"
 	"database/sql"
-	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"todogin/internal/config"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
 )
 
 type Database struct {
-	Conn *sql.DB
+	// Conn is the primary, every write goes there
+	Conn         *sql.DB
+	// Replicas serve the reads made through ReadStmt, they may be empty
+	Replicas     []*sql.DB
+	Dialect      Dialect
+	QueryTimeout time.Duration
+	stmts        *stmtRegistry
+	router       *replicaRouter
 }
 
 func DatabaseInit(conf *config.Config) (*Database, error) {
+	conn, err := openPool(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conf.DBReplicaAddrs) > 0 && conf.DBDriver == DriverSQLite {
+		conn.Close()
+		return nil, &DatabaseError{"sqlite does not support replicas", nil}
+	}
+
+	replicas := make([]*sql.DB, 0, len(conf.DBReplicaAddrs))
+	for _, addr := range conf.DBReplicaAddrs {
+		rconf := *conf
+		rconf.DBAddr = addr
+
+		replica, err := openPool(&rconf)
+		if err != nil {
+			for _, r := range replicas {
+				r.Close()
+			}
+			conn.Close()
+			return nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+
+	database := Database{
+		Conn        : conn,
+		Replicas    : replicas,
+		Dialect     : NewDialect(conf.DBDriver),
+		QueryTimeout: conf.DBQueryTimeout,
+		stmts       : newStmtRegistry(conn, conf.DBStmtCacheSize, conf.DBQueryTimeout),
+		router      : newReplicaRouter(replicas, conf),
+	}
+	return &database, nil
+}
+
+// openPool opens and pings the connection pool of conf.DBAddr
+func openPool(conf *config.Config) (*sql.DB, error) {
+	var conn *sql.DB
+	var err error
+
+	switch conf.DBDriver {
+	case DriverMySQL:
+		conn, err = openMySQL(conf)
+	case DriverSQLite:
+		conn, err = openSQLite(conf)
+	case DriverPostgres:
+		conn, err = openPostgres(conf)
+	default:
+		return nil, &DatabaseError{fmt.Sprintf("unsupported driver %q", conf.DBDriver), nil}
+	}
+	if err != nil {
+		return nil, &DatabaseError{"sql.Open fail", err}
+	}
+
+	configurePool(conn, conf)
+
+	err = pingWithRetry(conn, conf.DBConnectRetries, conf.DBConnectBackoff)
+	if err != nil {
+		conn.Close()
+		return nil, &DatabaseError{fmt.Sprintf("Ping %s fail", conf.DBAddr), err}
+	}
+
+	return conn, nil
+}
+
+// Now is the time the storage layer writes, in UTC and truncated to the
+// microsecond precision that every backend can store
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// WithTimeout bounds ctx by the configured per-query timeout
+func (d *Database) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d.QueryTimeout)
+}
+
+// Stmt returns the prepared statement of query, written with "?" placeholders,
+// for the database dialect. It is prepared once and shared, so don't close it.
+func (d *Database) Stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.stmts.get(ctx, d.Dialect.Rebind(query))
+}
+
+// ReadStmt is Stmt for read-only queries made on behalf of userId, they go to
+// a replica unless userId wrote recently (see MarkWrite) or there are none
+func (d *Database) ReadStmt(ctx context.Context, userId int, query string) (*sql.Stmt, error) {
+	return d.Reader(userId)(ctx, query)
+}
+
+// Reader picks once where the reads made on behalf of userId go, as
+// ReadStmt does, and prepares their statements there, so the reads of one
+// answer (a list and the tags of its todos) see the same replica
+func (d *Database) Reader(userId int) func(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmts := d.router.pick(userId)
+	if stmts == nil {
+		stmts = d.stmts
+	}
+	return func(ctx context.Context, query string) (*sql.Stmt, error) {
+		return stmts.get(ctx, d.Dialect.Rebind(query))
+	}
+}
+
+// MarkWrite records that userId just wrote, so their next reads go to the
+// primary until the replicas have caught up
+func (d *Database) MarkWrite(userId int) {
+	d.router.markWrite(userId)
+}
+
+// Close releases the prepared statements and the connection pools
+func (d *Database) Close() error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	keep(d.stmts.close())
+	keep(d.Conn.Close())
+	for i, replica := range d.Replicas {
+		keep(d.router.stmts[i].close())
+		keep(replica.Close())
+	}
+
+	return firstErr
+}
+
+// Insert runs an insert query and returns the id of the new row
+func (d *Database) Insert(ctx context.Context, query string, args ...any) (int, error) {
+	ctx, cancel := d.WithTimeout(ctx)
+	defer cancel()
+
+	stmt, err := d.Stmt(ctx, d.Dialect.InsertQuery(query))
+	if err != nil {
+		return 0, err
+	}
+
+	return d.Dialect.InsertId(ctx, stmt, args...)
+}
+
+func configurePool(conn *sql.DB, conf *config.Config) {
+	conn.SetMaxOpenConns(conf.DBMaxOpenConns)
+	conn.SetMaxIdleConns(conf.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(conf.DBConnMaxLifetime)
+	conn.SetConnMaxIdleTime(conf.DBConnMaxIdleTime)
+
+	// every connection to ":memory:" is a new empty database, so keep a
+	// single one and never let the pool close it
+	if conf.DBDriver == DriverSQLite && conf.DBPath == ":memory:" {
+		conn.SetMaxOpenConns(1)
+		conn.SetMaxIdleConns(1)
+		conn.SetConnMaxLifetime(0)
+		conn.SetConnMaxIdleTime(0)
+	}
+}
+
+// maxConnectBackoff caps the wait between two ping attempts
+const maxConnectBackoff = 30 * time.Second
+
+// pingWithRetry pings conn up to retries+1 times, doubling backoff between attempts
+func pingWithRetry(conn *sql.DB, retries int, backoff time.Duration) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = conn.Ping(); err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return err
+		}
+
+		log.Printf("(database.pingWithRetry) attempt %d/%d fail, retrying in %v: Err: %v\n", attempt + 1, retries + 1, backoff, err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+func openMySQL(conf *config.Config) (*sql.DB, error) {
 	mconf := mysql.Config{
 		Addr                : conf.DBAddr,
 		User                : conf.DBUser,
 		Passwd              : conf.DBPasswd,
 		DBName              : conf.DBName,
 		AllowNativePasswords: true,
+		ParseTime           : true,
+		// report matched instead of changed rows, so an update that
+		// keeps the same values is not mistaken for a missing row
+		ClientFoundRows     : true,
 	}
 
-	conn, err := sql.Open("mysql", mconf.FormatDSN())
-	if err != nil {
-		return nil, &DatabaseError{"sql.Open fail", err}
-	}
+	return sql.Open("mysql", mconf.FormatDSN())
+}
 
-	err = conn.Ping()
-	if err != nil {
-		return nil, &DatabaseError{"Ping fail", err}
+func openSQLite(conf *config.Config) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", conf.DBPath)
+	return sql.Open(sqliteDriver, dsn)
+}
+
+func openPostgres(conf *config.Config) (*sql.DB, error) {
+	dsn := url.URL{
+		Scheme  : "postgres",
+		User    : url.UserPassword(conf.DBUser, conf.DBPasswd),
+		Host    : conf.DBAddr,
+		Path    : conf.DBName,
+		RawQuery: url.Values{"sslmode": {conf.DBSSLMode}}.Encode(),
 	}
 
-	database := Database{Conn: conn} 
-	return &database, nil
+	return sql.Open("postgres", dsn.String())
 }
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dialect hides the sql differences between the supported backends.
+// Queries are written with "?" placeholders and rebound per dialect, booleans
+// are always passed as bind parameters so every driver maps them to its own
+// column type (TINYINT(1), INTEGER or BOOLEAN).
+type Dialect interface {
+	Name() string
+	// Rebind rewrites the "?" placeholders of query to the dialect ones
+	Rebind(query string) string
+	// ForUpdate is the locking clause appended to a select inside a transaction
+	ForUpdate() string
+	// InsertQuery adapts an insert query so InsertId can read the new id
+	InsertQuery(query string) string
+	// InsertId runs a statement built from InsertQuery and returns the new id
+	InsertId(ctx context.Context, stmt *sql.Stmt, args ...any) (int, error)
+	// IsDuplicate reports whether err is a unique or primary key violation
+	IsDuplicate(err error) bool
+	// InsertIgnore adapts an "insert into" query so a row that clashes with
+	// a unique or primary key is skipped rather than failing
+	InsertIgnore(query string) string
+}
+
+func NewDialect(driver string) Dialect {
+	switch driver {
+	case DriverPostgres:
+		return postgresDialect{}
+	case DriverSQLite:
+		return lastInsertIdDialect{DriverSQLite}
+	default:
+		return lastInsertIdDialect{DriverMySQL}
+	}
+}
+
+// lastInsertIdDialect is used by mysql and sqlite, both understand "?" and
+// report the new id through sql.Result.LastInsertId
+type lastInsertIdDialect struct {
+	name string
+}
+
+func (d lastInsertIdDialect) Name() string {
+	return d.name
+}
+
+// sqlite locks the whole database on write, it has no row locks
+func (d lastInsertIdDialect) ForUpdate() string {
+	if d.name == DriverSQLite {
+		return ""
+	}
+	return " for update"
+}
+
+func (d lastInsertIdDialect) Rebind(query string) string {
+	return query
+}
+
+func (d lastInsertIdDialect) InsertQuery(query string) string {
+	return query
+}
+
+func (d lastInsertIdDialect) InsertId(ctx context.Context, stmt *sql.Stmt, args ...any) (int, error) {
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (d lastInsertIdDialect) IsDuplicate(err error) bool {
+	if d.name == DriverSQLite {
+		var serr sqlite3.Error
+		return errors.As(err, &serr) && (serr.ExtendedCode == sqlite3.ErrConstraintUnique || serr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+	}
+
+	var merr *mysql.MySQLError
+	return errors.As(err, &merr) && merr.Number == 1062
+}
+
+func (d lastInsertIdDialect) InsertIgnore(query string) string {
+	if d.name == DriverSQLite {
+		return strings.Replace(query, "insert into", "insert or ignore into", 1)
+	}
+	return strings.Replace(query, "insert into", "insert ignore into", 1)
+}
+
+type postgresDialect struct{}
+
+func (d postgresDialect) Name() string {
+	return DriverPostgres
+}
+
+// Rebind turns "?" into "$1", "$2", ... skipping quoted strings
+func (d postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+			b.WriteRune(r)
+		case r == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func (d postgresDialect) ForUpdate() string {
+	return " for update"
+}
+
+func (d postgresDialect) InsertQuery(query string) string {
+	return query + " returning id"
+}
+
+func (d postgresDialect) InsertId(ctx context.Context, stmt *sql.Stmt, args ...any) (int, error) {
+	id := 0
+	err := stmt.QueryRowContext(ctx, args...).Scan(&id)
+	return id, err
+}
+
+func (d postgresDialect) IsDuplicate(err error) bool {
+	var perr *pq.Error
+	return errors.As(err, &perr) && perr.Code == "23505"
+}
+
+func (d postgresDialect) InsertIgnore(query string) string {
+	return query + " on conflict do nothing"
+}
@@ -2,6 +2,20 @@ package database
 
 import (
 	"fmt"
+	"errors"
+)
+
+// domain errors returned by the storage layer, wrap them with the resource
+// (e.g. fmt.Errorf("todo %d: %w", id, ErrNotFound)) so the message stays useful
+var (
+	// the row does not exist or is not owned by the caller
+	ErrNotFound        = errors.New("not found")
+	// the row clashes with an existing one (e.g. a taken email)
+	ErrConflict        = errors.New("already exists")
+	// the caller is known but not allowed to touch the row
+	ErrForbidden       = errors.New("forbidden")
+	// the row changed since the caller read it (a stale version)
+	ErrVersionMismatch = errors.New("version mismatch")
 )
 
 type DatabaseError struct {
@@ -10,5 +24,5 @@ type DatabaseError struct {
 }
 
 func (e *DatabaseError) Error() string {
-	return fmt.Sprintf("DatabaseError: %q: %w", e.msg, e.Err)
+	return fmt.Sprintf("DatabaseError: %q: %v", e.msg, e.Err)
 }
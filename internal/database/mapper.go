@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"database/sql"
+)
+
+// Fields maps column names to the scan destinations of a model
+type Fields map[string]any
+
+// Mapper is implemented by the models read from the database, the column
+// names of Fields are both what gets selected and how rows are matched
+type Mapper interface {
+	Fields() Fields
+}
+
+// Columns returns the comma separated column list of m for a select query,
+// qualified with table when it is not empty
+func Columns(m Mapper, table string) string {
+	names := make([]string, 0)
+	for name := range m.Fields() {
+		if table != "" {
+			name = table + "." + name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// ScanRow scans the current row of rows into m by column name, so the
+// order of the selected columns does not matter
+func ScanRow(rows *sql.Rows, m Mapper) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	fields := m.Fields()
+	dest := make([]any, len(cols))
+	for i, col := range cols {
+		ptr, ok := fields[col]
+		if !ok {
+			return fmt.Errorf("ScanRow: no field for column %q", col)
+		}
+		dest[i] = ptr
+	}
+
+	return rows.Scan(dest...)
+}
+
+// ScanOne scans the first row of rows into m and closes rows,
+// sql.ErrNoRows is returned when there is no row
+func ScanOne(rows *sql.Rows, m Mapper) error {
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	if err := ScanRow(rows, m); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"log"
+	"sort"
+	"time"
+	"io/fs"
+	"embed"
+	"context"
+	"strconv"
+	"strings"
+	"database/sql"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// the version table is the goose one, so databases migrated with the goose
+// binary and with the migrate subcommand stay interchangeable
+var versionTables = map[string]string{
+	DriverMySQL: `create table if not exists goose_db_version (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+		version_id BIGINT NOT NULL,
+		is_applied BOOLEAN NOT NULL,
+		tstamp TIMESTAMP NULL DEFAULT NOW(),
+		PRIMARY KEY(id)
+	)`,
+	DriverSQLite: `create table if not exists goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`,
+	DriverPostgres: `create table if not exists goose_db_version (
+		id SERIAL PRIMARY KEY NOT NULL,
+		version_id BIGINT NOT NULL,
+		is_applied BOOLEAN NOT NULL,
+		tstamp TIMESTAMP NULL DEFAULT now()
+	)`,
+}
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations of the database dialect ordered by version
+func (d *Database) Migrations() ([]Migration, error) {
+	dir := "migrations/" + d.Dialect.Name()
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, &DatabaseError{"read migrations fail", err}
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version, err := strconv.ParseInt(strings.SplitN(entry.Name(), "_", 2)[0], 10, 64)
+		if err != nil {
+			return nil, &DatabaseError{"invalid migration name " + entry.Name(), err}
+		}
+
+		content, err := migrationsFS.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, &DatabaseError{"read migration fail", err}
+		}
+
+		up, down := parseMigration(string(content))
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name   : entry.Name(),
+			Up     : up,
+			Down   : down,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration
+func (d *Database) MigrateUp() error {
+	migrations, applied, err := d.migrationState()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := d.runMigration(m, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the latest applied migration
+func (d *Database) MigrateDown() error {
+	m, err := d.lastApplied()
+	if err != nil {
+		return err
+	}
+
+	return d.runMigration(*m, false)
+}
+
+// MigrateRedo rolls back the latest applied migration and applies it again
+func (d *Database) MigrateRedo() error {
+	m, err := d.lastApplied()
+	if err != nil {
+		return err
+	}
+
+	if err := d.runMigration(*m, false); err != nil {
+		return err
+	}
+	return d.runMigration(*m, true)
+}
+
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, applied, err := d.migrationState()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+func (d *Database) lastApplied() (*Migration, error) {
+	migrations, applied, err := d.migrationState()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if _, ok := applied[migrations[i].Version]; ok {
+			return &migrations[i], nil
+		}
+	}
+
+	return nil, &DatabaseError{"no applied migration to roll back", nil}
+}
+
+// migrationState returns the embedded migrations and the applied versions with their apply time
+func (d *Database) migrationState() ([]Migration, map[int64]time.Time, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := d.ensureVersionTable(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := d.Conn.Query("select version_id, is_applied, tstamp from goose_db_version order by id")
+	if err != nil {
+		return nil, nil, &DatabaseError{"read goose_db_version fail", err}
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, nil, &DatabaseError{"read goose_db_version fail", err}
+		}
+
+		if isApplied {
+			applied[version] = tstamp.Time
+		} else {
+			delete(applied, version)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, &DatabaseError{"read goose_db_version fail", err}
+	}
+
+	return migrations, applied, nil
+}
+
+func (d *Database) ensureVersionTable() error {
+	create, ok := versionTables[d.Dialect.Name()]
+	if !ok {
+		return &DatabaseError{"no migration support for " + d.Dialect.Name(), nil}
+	}
+
+	if _, err := d.Conn.Exec(create); err != nil {
+		return &DatabaseError{"create goose_db_version fail", err}
+	}
+
+	// goose marks an initialized version table with a version 0 row
+	count := 0
+	if err := d.Conn.QueryRow("select count(*) from goose_db_version").Scan(&count); err != nil {
+		return &DatabaseError{"read goose_db_version fail", err}
+	}
+	if count == 0 {
+		_, err := d.Conn.Exec(d.Dialect.Rebind("insert into goose_db_version(version_id, is_applied) values (?, ?)"), 0, true)
+		if err != nil {
+			return &DatabaseError{"init goose_db_version fail", err}
+		}
+	}
+
+	return nil
+}
+
+func (d *Database) runMigration(m Migration, up bool) error {
+	statements := m.Down
+	direction  := "down"
+	if up {
+		statements = m.Up
+		direction  = "up"
+	}
+
+	err := d.WithTx(context.Background(), func(tx *Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return &DatabaseError{"migrate " + direction + " " + m.Name + " fail", err}
+			}
+		}
+
+		var err error
+		if up {
+			_, err = tx.Exec(d.Dialect.Rebind("insert into goose_db_version(version_id, is_applied) values (?, ?)"), m.Version, true)
+		} else {
+			_, err = tx.Exec(d.Dialect.Rebind("delete from goose_db_version where version_id=?"), m.Version)
+		}
+		if err != nil {
+			return &DatabaseError{"update goose_db_version fail", err}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("(migrate %s) OK %s\n", direction, m.Name)
+	return nil
+}
+
+// parseMigration splits a goose sql file into its up and down statements
+func parseMigration(content string) ([]string, []string) {
+	var up, down []string
+	var current *[]string
+	var stmt strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" && current != nil {
+			*current = append(*current, s)
+		}
+		stmt.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "-- +goose Up"):
+			flush()
+			current = &up
+			continue
+		case strings.HasPrefix(trimmed, "-- +goose Down"):
+			flush()
+			current = &down
+			continue
+		case strings.HasPrefix(trimmed, "-- +goose StatementBegin"):
+			flush()
+			inBlock = true
+			continue
+		case strings.HasPrefix(trimmed, "-- +goose StatementEnd"):
+			flush()
+			inBlock = false
+			continue
+		case strings.HasPrefix(trimmed, "--"), trimmed == "":
+			continue
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+
+	return up, down
+}
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE `todo_revisions` (
+    id INT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    todo_id INT UNSIGNED NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content VARCHAR(255) NOT NULL,
+    done TINYINT(1) NOT NULL,
+    changes TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    INDEX todo_revisions_todo_id (todo_id, id),
+    FOREIGN KEY(todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS `todo_revisions`;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN completed_at DATETIME(6) NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE todos SET completed_at = updated_at WHERE done = 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN completed_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN updated_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN created_at;
+-- +goose StatementEnd
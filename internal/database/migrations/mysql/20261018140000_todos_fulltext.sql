@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD FULLTEXT INDEX todos_fulltext (title, content);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP INDEX todos_fulltext;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN due_at DATETIME(6) NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN remind_at DATETIME(6) NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN reminded_at DATETIME(6) NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX todos_user_due_at ON todos(user_id, due_at);
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX todos_remind_at ON todos(remind_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX todos_remind_at ON todos;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX todos_user_due_at ON todos;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN reminded_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN remind_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN due_at;
+-- +goose StatementEnd
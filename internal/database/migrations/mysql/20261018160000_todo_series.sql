@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE `todo_series` (
+    id INT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content VARCHAR(255) NOT NULL,
+    rrule VARCHAR(255) NOT NULL,
+    start_at DATETIME(6) NOT NULL,
+    remind_before INT NULL,
+    ended_at DATETIME(6) NULL,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN rrule VARCHAR(255) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN series_id INT UNSIGNED NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN recurrence_at DATETIME(6) NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX todos_series_id ON todos(series_id, recurrence_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX todos_series_id ON todos;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN recurrence_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN series_id;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN rrule;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TABLE IF EXISTS `todo_series`;
+-- +goose StatementEnd
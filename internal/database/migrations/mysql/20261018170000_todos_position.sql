@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN priority INT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN position DOUBLE NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+-- the todos keep the order of their ids, a gap apart
+-- +goose StatementBegin
+UPDATE todos SET position = id * 1024;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX todos_user_position ON todos(user_id, position);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todo_series ADD COLUMN priority INT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todo_series DROP COLUMN priority;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX todos_user_position ON todos;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN position;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN priority;
+-- +goose StatementEnd
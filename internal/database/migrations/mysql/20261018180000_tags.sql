@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE `tags` (
+    id INT UNSIGNED PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '',
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    UNIQUE INDEX tags_user_name (user_id, name),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TABLE `todo_tags` (
+    todo_id INT UNSIGNED NOT NULL,
+    tag_id INT UNSIGNED NOT NULL,
+    PRIMARY KEY(todo_id, tag_id),
+    INDEX todo_tags_tag_id (tag_id),
+    FOREIGN KEY(todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+    FOREIGN KEY(tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS `todo_tags`;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TABLE IF EXISTS `tags`;
+-- +goose StatementEnd
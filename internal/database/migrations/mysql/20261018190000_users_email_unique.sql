@@ -0,0 +1,10 @@
+-- +goose Up
+-- emails are checked before the insert, the index catches concurrent signups
+-- +goose StatementBegin
+CREATE UNIQUE INDEX users_email ON users(email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_email ON users;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT (now() at time zone 'utc');
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT (now() at time zone 'utc');
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN completed_at TIMESTAMP NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE todos SET completed_at = updated_at WHERE done;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN completed_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN updated_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN created_at;
+-- +goose StatementEnd
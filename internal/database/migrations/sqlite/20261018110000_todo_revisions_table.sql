@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE `todo_revisions` (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    todo_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content VARCHAR(255) NOT NULL,
+    done INTEGER NOT NULL,
+    changes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY(todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX todo_revisions_todo_id ON todo_revisions(todo_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS `todo_revisions`;
+-- +goose StatementEnd
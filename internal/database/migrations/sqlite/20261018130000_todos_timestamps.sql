@@ -0,0 +1,29 @@
+-- +goose Up
+-- sqlite cannot add a column defaulting to CURRENT_TIMESTAMP, so the
+-- existing rows are stamped by the update below
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN completed_at TIMESTAMP NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE todos SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE todos SET completed_at = updated_at WHERE done = 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN completed_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN updated_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN created_at;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- todos_fts indexes the title and content of todos, the triggers keep it in
+-- sync since an external content table is not updated by itself
+-- +goose StatementBegin
+CREATE VIRTUAL TABLE todos_fts USING fts4(content="todos", title, content);
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TRIGGER todos_fts_bu BEFORE UPDATE ON todos BEGIN
+    DELETE FROM todos_fts WHERE docid = old.id;
+END;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TRIGGER todos_fts_bd BEFORE DELETE ON todos BEGIN
+    DELETE FROM todos_fts WHERE docid = old.id;
+END;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TRIGGER todos_fts_au AFTER UPDATE ON todos BEGIN
+    INSERT INTO todos_fts(docid, title, content) VALUES (new.id, new.title, new.content);
+END;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TRIGGER todos_fts_ai AFTER INSERT ON todos BEGIN
+    INSERT INTO todos_fts(docid, title, content) VALUES (new.id, new.title, new.content);
+END;
+-- +goose StatementEnd
+-- +goose StatementBegin
+INSERT INTO todos_fts(todos_fts) VALUES ('rebuild');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS todos_fts_ai;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS todos_fts_au;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS todos_fts_bd;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS todos_fts_bu;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TABLE IF EXISTS todos_fts;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN due_at TIMESTAMP NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN remind_at TIMESTAMP NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos ADD COLUMN reminded_at TIMESTAMP NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX todos_user_due_at ON todos(user_id, due_at);
+-- +goose StatementEnd
+-- the scheduler only looks for the reminders not delivered yet
+-- +goose StatementBegin
+CREATE INDEX todos_pending_reminders ON todos(remind_at) WHERE reminded_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX todos_pending_reminders;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX todos_user_due_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN reminded_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN remind_at;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN due_at;
+-- +goose StatementEnd
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"sync"
+	"time"
+	"sync/atomic"
+	"database/sql"
+	"todogin/internal/config"
+)
+
+// pruneWritesAt is the size after which expired entries of
+// replicaRouter.writes are dropped
+const pruneWritesAt = 1024
+
+// replicaRouter spreads the reads over the replicas round robin and keeps
+// the users that wrote within the read-your-writes window on the primary
+type replicaRouter struct {
+	stmts  []*stmtRegistry
+	next   atomic.Uint64
+	window time.Duration
+
+	mu     sync.Mutex
+	writes map[int]time.Time
+}
+
+func newReplicaRouter(replicas []*sql.DB, conf *config.Config) *replicaRouter {
+	stmts := make([]*stmtRegistry, 0, len(replicas))
+	for _, replica := range replicas {
+		stmts = append(stmts, newStmtRegistry(replica, conf.DBStmtCacheSize, conf.DBQueryTimeout))
+	}
+
+	return &replicaRouter{
+		stmts : stmts,
+		window: conf.DBReadYourWritesWindow,
+		writes: make(map[int]time.Time),
+	}
+}
+
+// pick returns the statements of the replica to read from, nil means the primary
+func (r *replicaRouter) pick(userId int) *stmtRegistry {
+	if len(r.stmts) == 0 {
+		return nil
+	}
+
+	if userId != 0 && r.window > 0 {
+		r.mu.Lock()
+		wroteAt, ok := r.writes[userId]
+		r.mu.Unlock()
+
+		if ok && time.Since(wroteAt) < r.window {
+			return nil
+		}
+	}
+
+	n := r.next.Add(1)
+	return r.stmts[n % uint64(len(r.stmts))]
+}
+
+func (r *replicaRouter) markWrite(userId int) {
+	if len(r.stmts) == 0 || r.window <= 0 || userId == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writes[userId] = now
+	if len(r.writes) > pruneWritesAt {
+		for id, wroteAt := range r.writes {
+			if now.Sub(wroteAt) >= r.window {
+				delete(r.writes, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the sqlite3 driver with the functions below registered
+// on every connection
+const sqliteDriver = "sqlite3_todogin"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("fts_rank", ftsRank, true)
+		},
+	})
+}
+
+// ftsRank scores a fts4 row from its matchinfo(t, 'pcx') blob, fts4 has no
+// ranking function of its own: for every phrase and column, the hits in the
+// row over the hits in all the rows, weighed by the weight of the column
+// (1 for the columns without one)
+func ftsRank(info []byte, weights ...float64) float64 {
+	ints := make([]uint32, len(info)/4)
+	for i := range ints {
+		ints[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(ints) < 2 {
+		return 0
+	}
+
+	phrases, cols := int(ints[0]), int(ints[1])
+	score := 0.0
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < cols; c++ {
+			i := 2 + 3*(p*cols+c)
+			if i+1 >= len(ints) || ints[i+1] == 0 {
+				continue
+			}
+			weight := 1.0
+			if c < len(weights) {
+				weight = weights[c]
+			}
+			score += weight * float64(ints[i]) / float64(ints[i+1])
+		}
+	}
+	return score
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"sync"
+	"time"
+	"context"
+	"database/sql"
+	"container/list"
+)
+
+// stmtCloseGrace is how long an evicted statement stays open when queries
+// have no timeout, a caller may still be about to run it
+const stmtCloseGrace = time.Minute
+
+// stmtRegistry keeps a prepared statement per query of a connection pool,
+// the least recently used ones are closed past size. The list queries are
+// built from their filters and sort keys, so the distinct queries are not
+// bounded by the code. *sql.Stmt is safe for concurrent use and re-prepares
+// itself on the pool connections it has not seen yet.
+type stmtRegistry struct {
+	conn  *sql.DB
+	size  int
+	grace time.Duration
+	mu    sync.Mutex
+	stmts map[string]*list.Element
+	// lru holds the *cachedStmt, the most recently used first
+	lru   *list.List
+}
+
+type cachedStmt struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+// newStmtRegistry caches up to size statements of conn (none when size is
+// 0), queryTimeout is the longest a caller runs a statement it got (0 for
+// no limit)
+func newStmtRegistry(conn *sql.DB, size int, queryTimeout time.Duration) *stmtRegistry {
+	grace := queryTimeout
+	if grace <= 0 {
+		grace = stmtCloseGrace
+	}
+
+	return &stmtRegistry{
+		conn : conn,
+		size : size,
+		grace: grace,
+		stmts: make(map[string]*list.Element),
+		lru  : list.New(),
+	}
+}
+
+func (r *stmtRegistry) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	if r.size <= 0 {
+		return r.prepareOnce(ctx, query)
+	}
+
+	r.mu.Lock()
+	if elem, ok := r.stmts[query]; ok {
+		r.lru.MoveToFront(elem)
+		r.mu.Unlock()
+		return elem.Value.(*cachedStmt).stmt, nil
+	}
+	r.mu.Unlock()
+
+	// prepare outside of the lock, so a slow prepare doesn't block the
+	// other queries, and keep the first statement if two goroutines raced
+	stmt, err := r.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.stmts[query]; ok {
+		stmt.Close()
+		r.lru.MoveToFront(elem)
+		return elem.Value.(*cachedStmt).stmt, nil
+	}
+	r.stmts[query] = r.lru.PushFront(&cachedStmt{query, stmt})
+
+	for r.lru.Len() > r.size {
+		r.evict(r.lru.Back())
+	}
+
+	return stmt, nil
+}
+
+// evict drops elem from the cache, its statement is closed once the callers
+// that got it before are done with it (a running query keeps it open on its
+// own, this covers the ones about to run it), caller must hold the lock
+func (r *stmtRegistry) evict(elem *list.Element) {
+	cached := r.lru.Remove(elem).(*cachedStmt)
+	delete(r.stmts, cached.query)
+
+	time.AfterFunc(r.grace, func() {
+		cached.stmt.Close()
+	})
+}
+
+// prepareOnce prepares query for a single caller when caching is off, it
+// is closed as an evicted statement would be
+func (r *stmtRegistry) prepareOnce(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := r.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	time.AfterFunc(r.grace, func() {
+		stmt.Close()
+	})
+	return stmt, nil
+}
+
+// len is how many statements are cached
+func (r *stmtRegistry) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lru.Len()
+}
+
+func (r *stmtRegistry) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for query, elem := range r.stmts {
+		if err := elem.Value.(*cachedStmt).stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.stmts, query)
+	}
+	r.lru.Init()
+
+	return firstErr
+}
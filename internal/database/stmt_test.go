@@ -0,0 +1,73 @@
+package database
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"testing"
+	"database/sql"
+)
+
+func TestStmtRegistry(t *testing.T) {
+	conn, err := sql.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	r := newStmtRegistry(conn, 2, 10 * time.Millisecond)
+	defer r.close()
+
+	first, err := r.get(ctx, "select 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := r.get(ctx, "select 1"); again != first {
+		t.Fatal("a cached query was prepared again")
+	}
+
+	// "select 1" was used last, so "select 2" is the one evicted
+	r.get(ctx, "select 2")
+	r.get(ctx, "select 1")
+	evicted, _ := r.get(ctx, "select 2")
+	for i := 3; i <= 10; i++ {
+		if _, err := r.get(ctx, fmt.Sprintf("select %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := r.len(); n != 2 {
+		t.Fatalf("cached %d statements, want 2", n)
+	}
+
+	// the evicted statement still runs until the grace period is over
+	var n int
+	if err := evicted.QueryRowContext(ctx).Scan(&n); err != nil || n != 2 {
+		t.Fatalf("evicted statement: %d, %v", n, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := evicted.QueryRowContext(ctx).Scan(&n); err == nil {
+		t.Fatal("evicted statement is still open after the grace period")
+	}
+}
+
+func TestStmtRegistryUncached(t *testing.T) {
+	conn, err := sql.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	r := newStmtRegistry(conn, 0, time.Second)
+
+	first, _  := r.get(ctx, "select 1")
+	second, _ := r.get(ctx, "select 1")
+	if first == second {
+		t.Fatal("uncached registry shared a statement")
+	}
+	if n := r.len(); n != 0 {
+		t.Fatalf("uncached registry kept %d statements", n)
+	}
+}
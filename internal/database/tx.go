@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Tx is a transaction on the primary with its own statement cache,
+// statements prepared through it are released on commit or rollback
+type Tx struct {
+	*sql.Tx
+	db    *Database
+	stmts map[string]*sql.Stmt
+}
+
+// WithTx runs fn inside a transaction, it is committed when fn returns nil
+// and rolled back when fn fails or panics
+func (d *Database) WithTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	sqlTx, err := d.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{Tx: sqlTx, db: d, stmts: make(map[string]*sql.Stmt)}
+
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return sqlTx.Commit()
+}
+
+// Stmt is Database.Stmt bound to the transaction, the statement is prepared
+// once per transaction so loops over many rows don't prepare it again
+func (tx *Tx) Stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	query = tx.db.Dialect.Rebind(query)
+	if stmt, ok := tx.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := tx.Tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	tx.stmts[query] = stmt
+
+	return stmt, nil
+}
+
+// Insert is Database.Insert inside the transaction
+func (tx *Tx) Insert(ctx context.Context, query string, args ...any) (int, error) {
+	stmt, err := tx.Stmt(ctx, tx.db.Dialect.InsertQuery(query))
+	if err != nil {
+		return 0, err
+	}
+
+	return tx.db.Dialect.InsertId(ctx, stmt, args...)
+}
+
+// Savepoint runs fn inside a savepoint of the transaction, when fn fails its
+// changes are rolled back and the transaction goes on. fnErr is the error of
+// fn, err a failure of the savepoint itself that leaves the transaction
+// unusable.
+func (tx *Tx) Savepoint(ctx context.Context, name string, fn func() error) (fnErr error, err error) {
+	if _, err := tx.ExecContext(ctx, "savepoint "+name); err != nil {
+		return nil, err
+	}
+
+	if fnErr = fn(); fnErr != nil {
+		if _, err := tx.ExecContext(ctx, "rollback to savepoint "+name); err != nil {
+			return fnErr, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "release savepoint "+name)
+	return fnErr, err
+}